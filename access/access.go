@@ -0,0 +1,115 @@
+// Package access decides which resources the authenticated user of a request may act on.
+// Every route that takes the id of a patient, doctor, appointment or invoice checks it with
+// one of the policies here instead of trusting the id.
+package access
+
+import (
+	"doc-connect/models"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ErrForbidden is returned when the user may not act on a resource
+var ErrForbidden = errors.New("access denied")
+
+// Principal is the authenticated user making a request
+type Principal struct {
+	Role       string
+	PatientID  int    // of a patient
+	DoctorID   uint   // of a doctor
+	HospitalID uint   // of hospital staff, the only hospital they work for
+	Username   string // of an admin
+	AdminRole  string // of an admin, see Can
+}
+
+// IsAdmin reports whether the user administers the whole platform
+func (p Principal) IsAdmin() bool {
+	return p.Role == models.RoleAdmin || p.Role == models.RoleSuperAdmin
+}
+
+// SetPrincipal keeps the authenticated user in the request context
+func SetPrincipal(c *gin.Context, p Principal) {
+	c.Set("principal", p)
+}
+
+// FromContext returns the authenticated user of a request
+func FromContext(c *gin.Context) (Principal, bool) {
+	p, ok := c.Get("principal")
+	if !ok {
+		return Principal{}, false
+	}
+	principal, ok := p.(Principal)
+	return principal, ok
+}
+
+// Patient allows patients their own records, and admins everyone's
+func Patient(p Principal, patientID int) error {
+	if p.IsAdmin() || (p.Role == models.RolePatient && p.PatientID == patientID) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// PatientParam is Patient for a patient id taken from the request
+func PatientParam(p Principal, patientID string) error {
+	id, err := strconv.Atoi(patientID)
+	if err != nil {
+		return ErrForbidden
+	}
+	return Patient(p, id)
+}
+
+// Doctor allows doctors their own records, hospital staff the doctors of their hospital, and
+// admins every doctor
+func Doctor(tx *gorm.DB, p Principal, doctorID uint) error {
+	switch {
+	case p.IsAdmin():
+		return nil
+	case p.Role == models.RoleDoctor:
+		if p.DoctorID == doctorID {
+			return nil
+		}
+	case p.Role == models.RoleHospitalStaff:
+		return doctorOfHospital(tx, doctorID, p.HospitalID)
+	}
+	return ErrForbidden
+}
+
+// DoctorParam is Doctor for a doctor id taken from the request
+func DoctorParam(tx *gorm.DB, p Principal, doctorID string) error {
+	id, err := strconv.ParseUint(doctorID, 10, 64)
+	if err != nil {
+		return ErrForbidden
+	}
+	return Doctor(tx, p, uint(id))
+}
+
+// Appointment allows an appointment to its patient and to whoever may act for its doctor
+func Appointment(tx *gorm.DB, p Principal, appointment models.Appointment) error {
+	if p.Role == models.RolePatient {
+		return Patient(p, appointment.PatientID)
+	}
+	return Doctor(tx, p, uint(appointment.DoctorID))
+}
+
+// Invoice allows an invoice to its patient and to whoever may act for its doctor
+func Invoice(tx *gorm.DB, p Principal, invoice models.Invoice) error {
+	if p.Role == models.RolePatient {
+		return Patient(p, int(invoice.PatientID))
+	}
+	return Doctor(tx, p, invoice.DoctorID)
+}
+
+func doctorOfHospital(tx *gorm.DB, doctorID, hospitalID uint) error {
+	var count int64
+	if err := tx.Model(&models.Doctor{}).Where("doctor_id = ? AND hospital_id = ?", doctorID, hospitalID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package access_test
+
+import (
+	"doc-connect/access"
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var (
+	patient    = access.Principal{Role: models.RolePatient, PatientID: 1}
+	doctor     = access.Principal{Role: models.RoleDoctor, DoctorID: 1}
+	admin      = access.Principal{Role: models.RoleAdmin, Username: "admin", AdminRole: models.AdminRoleSupport}
+	superAdmin = access.Principal{Role: models.RoleSuperAdmin, Username: "root"}
+	// Staff of hospital 1 and of hospital 2
+	staff      = access.Principal{Role: models.RoleHospitalStaff, HospitalID: 1}
+	otherStaff = access.Principal{Role: models.RoleHospitalStaff, HospitalID: 2}
+)
+
+// policyCase is a user acting on a resource and whether the policy allows it
+type policyCase struct {
+	name      string
+	principal access.Principal
+	allowed   bool
+}
+
+func checkPolicy(t *testing.T, tt policyCase, err error) {
+	t.Helper()
+	switch {
+	case tt.allowed && err != nil:
+		t.Errorf("denied with %v, want allowed", err)
+	case !tt.allowed && !errors.Is(err, access.ErrForbidden):
+		t.Errorf("got %v, want %v", err, access.ErrForbidden)
+	}
+}
+
+// useTestDB returns a transaction on the postgres database of TEST_DATABASE_DSN, rolled back
+// when the test ends. Tests of hospital staff are skipped when it isn't set.
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("Failed to connect to the database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Doctor{}); err != nil {
+		t.Fatalf("Failed to migrate doctors: %v", err)
+	}
+
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// createDoctor stores a doctor working for a hospital
+func createDoctor(t *testing.T, tx *gorm.DB, hospitalID uint) models.Doctor {
+	t.Helper()
+	doctor := models.Doctor{
+		Name:           "Doctor",
+		Gender:         "female",
+		Specialization: "General",
+		Email:          fmt.Sprintf("access-test-hospital%d@example.com", hospitalID),
+		Password:       "secret",
+		Phone:          "9999999999",
+		LicenseNumber:  "LIC",
+		HospitalID:     hospitalID,
+	}
+	if err := tx.Create(&doctor).Error; err != nil {
+		t.Fatalf("Failed to create doctor: %v", err)
+	}
+	return doctor
+}
+
+func TestPatient(t *testing.T) {
+	tests := []policyCase{
+		{"own records", patient, true},
+		{"another patient", access.Principal{Role: models.RolePatient, PatientID: 2}, false},
+		{"doctor", doctor, false},
+		{"hospital staff", staff, false},
+		{"admin", admin, true},
+		{"super admin", superAdmin, true},
+		{"nobody", access.Principal{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPolicy(t, tt, access.Patient(tt.principal, 1))
+		})
+	}
+}
+
+func TestPatientParam(t *testing.T) {
+	tests := []struct {
+		policyCase
+		patientID string
+	}{
+		{policyCase{"own records", patient, true}, "1"},
+		{policyCase{"another patient", patient, false}, "2"},
+		{policyCase{"non-numeric id", patient, false}, "1abc"},
+		{policyCase{"empty id", patient, false}, ""},
+		{policyCase{"doctor with the same id", doctor, false}, "1"},
+		{policyCase{"admin", admin, true}, "2"},
+		{policyCase{"admin with a non-numeric id", admin, false}, "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPolicy(t, tt.policyCase, access.PatientParam(tt.principal, tt.patientID))
+		})
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	// None of these look the doctor up, so they run without a database
+	tests := []policyCase{
+		{"own records", doctor, true},
+		{"another doctor", access.Principal{Role: models.RoleDoctor, DoctorID: 2}, false},
+		{"patient with the same id", patient, false},
+		{"admin", admin, true},
+		{"super admin", superAdmin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPolicy(t, tt, access.Doctor(nil, tt.principal, 1))
+		})
+	}
+}
+
+func TestDoctorParam(t *testing.T) {
+	tests := []struct {
+		policyCase
+		doctorID string
+	}{
+		{policyCase{"own records", doctor, true}, "1"},
+		{policyCase{"another doctor", doctor, false}, "2"},
+		{policyCase{"non-numeric id", doctor, false}, "abc"},
+		{policyCase{"negative id", doctor, false}, "-1"},
+		{policyCase{"patient", patient, false}, "1"},
+		{policyCase{"admin", admin, true}, "2"},
+		{policyCase{"admin with a non-numeric id", admin, false}, "1abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPolicy(t, tt.policyCase, access.DoctorParam(nil, tt.principal, tt.doctorID))
+		})
+	}
+}
+
+func TestAppointment(t *testing.T) {
+	appointment := models.Appointment{AppointmentID: 10, PatientID: 1, DoctorID: 1}
+	tests := []policyCase{
+		{"its patient", patient, true},
+		{"another patient", access.Principal{Role: models.RolePatient, PatientID: 2}, false},
+		{"its doctor", doctor, true},
+		{"another doctor", access.Principal{Role: models.RoleDoctor, DoctorID: 2}, false},
+		{"admin", admin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPolicy(t, tt, access.Appointment(nil, tt.principal, appointment))
+		})
+	}
+}
+
+func TestInvoice(t *testing.T) {
+	invoice := models.Invoice{InvoiceID: 20, PatientID: 1, DoctorID: 1}
+	tests := []policyCase{
+		{"its patient", patient, true},
+		{"another patient", access.Principal{Role: models.RolePatient, PatientID: 2}, false},
+		{"its doctor", doctor, true},
+		{"another doctor", access.Principal{Role: models.RoleDoctor, DoctorID: 2}, false},
+		{"admin", admin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPolicy(t, tt, access.Invoice(nil, tt.principal, invoice))
+		})
+	}
+}
+
+func TestHospitalStaff(t *testing.T) {
+	tx := useTestDB(t)
+	doctorID := createDoctor(t, tx, staff.HospitalID).DoctorID
+	appointment := models.Appointment{AppointmentID: 10, PatientID: 1, DoctorID: int(doctorID)}
+	invoice := models.Invoice{InvoiceID: 20, PatientID: 1, DoctorID: doctorID}
+
+	for _, tt := range []policyCase{
+		{"staff of the doctor's hospital", staff, true},
+		{"staff of another hospital", otherStaff, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("Doctor", func(t *testing.T) { checkPolicy(t, tt, access.Doctor(tx, tt.principal, doctorID)) })
+			t.Run("DoctorParam", func(t *testing.T) { checkPolicy(t, tt, access.DoctorParam(tx, tt.principal, fmt.Sprint(doctorID))) })
+			t.Run("Appointment", func(t *testing.T) { checkPolicy(t, tt, access.Appointment(tx, tt.principal, appointment)) })
+			t.Run("Invoice", func(t *testing.T) { checkPolicy(t, tt, access.Invoice(tx, tt.principal, invoice)) })
+			t.Run("Patient", func(t *testing.T) {
+				checkPolicy(t, policyCase{tt.name, tt.principal, false}, access.Patient(tt.principal, 1))
+			})
+		})
+	}
+
+	for _, tt := range []struct {
+		policyCase
+		doctorID string
+	}{
+		{policyCase{"unknown doctor", staff, false}, fmt.Sprint(doctorID + 1000)},
+		{policyCase{"non-numeric id", staff, false}, "abc"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPolicy(t, tt.policyCase, access.DoctorParam(tx, tt.principal, tt.doctorID))
+		})
+	}
+}
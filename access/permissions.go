@@ -0,0 +1,49 @@
+package access
+
+import "doc-connect/models"
+
+// Permission is a part of the platform admins can be allowed to administer
+type Permission string
+
+const (
+	ManageHospitals     Permission = "manage_hospitals"
+	ViewDoctors         Permission = "view_doctors"
+	VerifyDoctors       Permission = "verify_doctors"
+	ViewBookings        Permission = "view_bookings"
+	ManageBookingPolicy Permission = "manage_booking_policy"
+	ViewRevenue         Permission = "view_revenue"
+	ManageBilling       Permission = "manage_billing" // invoices, refunds, refund rules and coupons
+	ManagePayouts       Permission = "manage_payouts"
+	ViewJobs            Permission = "view_jobs"
+	ManageAdmins        Permission = "manage_admins"
+)
+
+// adminRolePermissions lists what each admin role can administer. Super admins can administer
+// everything.
+var adminRolePermissions = map[string][]Permission{
+	models.AdminRoleFinance:  {ViewBookings, ViewRevenue, ManageBilling, ManagePayouts},
+	models.AdminRoleVerifier: {ManageHospitals, ViewDoctors, VerifyDoctors},
+	models.AdminRoleSupport:  {ViewDoctors, ViewBookings, ManageBookingPolicy, ViewJobs},
+}
+
+// IsAdminRole reports whether role is a role admins can have
+func IsAdminRole(role string) bool {
+	_, ok := adminRolePermissions[role]
+	return ok || role == models.AdminRoleSuperAdmin
+}
+
+// Can reports whether the user holds a permission
+func (p Principal) Can(permission Permission) bool {
+	if p.Role == models.RoleSuperAdmin {
+		return true
+	}
+	if p.Role != models.RoleAdmin {
+		return false
+	}
+	for _, granted := range adminRolePermissions[p.AdminRole] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -1,65 +1,65 @@
 package authentication
 
 import (
+	"doc-connect/access"
+	"doc-connect/configuration"
 	"doc-connect/models"
 	"errors"
 	"net/http"
 	"strings"
-	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-var jwtkey = []byte("adminkey")
+// AdminAuthMiddleware lets active admins through that hold all of the given permissions. The
+// account is read on every request, so disabling an admin or changing their role applies at once.
+func AdminAuthMiddleware(permissions ...access.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authenticate(c, models.RoleAdmin)
+		if !ok {
+			return
+		}
 
-func GenerateAdminToken(username string) (string, error) {
-	//setting token expiration time
+		var admin models.Admin
+		if err := configuration.DB.Where("username = ? AND status = ?", claims.Subject, models.AdminActive).First(&admin).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin account is not active"})
+			return
+		}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+		principal := access.Principal{Role: models.RoleAdmin, Username: admin.Username, AdminRole: admin.Role}
+		if admin.Role == models.AdminRoleSuperAdmin {
+			principal.Role = models.RoleSuperAdmin
+		}
+		for _, permission := range permissions {
+			if !principal.Can(permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "your admin role doesn't allow this"})
+				return
+			}
+		}
 
-	claims := &models.AdminClaims{
-		Username:       username,
-		StandardClaims: jwt.StandardClaims{ExpiresAt: expirationTime.Unix()},
+		c.Set("username", admin.Username)
+		access.SetPrincipal(c, principal)
+		c.Next()
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtkey)
 }
 
-// verify Admin Token
-func AdminAuthentication(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.AdminClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtkey, nil
-	})
-	if err != nil {
-		return "", err
+// authenticate checks the access token of the request and keeps its claims in the context.
+// It aborts the request if the token isn't valid for the role.
+func authenticate(c *gin.Context, role string) (*models.AuthClaims, bool) {
+	tokenString := c.GetHeader("Authorization")
+	if tokenString == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing the authorization header"})
+		return nil, false
 	}
 
-	if claims, ok := token.Claims.(*models.AdminClaims); ok && token.Valid {
-		return claims.Username, nil
-	}
-	return "", errors.New("invalid token")
-}
-
-//Admin Auth middleware
-
-func AdminAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
-
-		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing the authorization header"})
-			return
-		}
-
-		authHeader := strings.TrimSpace(strings.TrimPrefix(tokenString, "Bearer"))
-
-		username, err := AdminAuthentication(authHeader)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-			return
-		}
-		c.Set("username", username)
-		c.Next()
+	claims, err := VerifyAccessToken(role, strings.TrimSpace(strings.TrimPrefix(tokenString, "Bearer")))
+	if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrSessionRevoked) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+		return nil, false
 	}
+	c.Set("claims", claims)
+	return claims, true
 }
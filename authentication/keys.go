@@ -0,0 +1,20 @@
+package authentication
+
+import (
+	"doc-connect/configuration"
+	"errors"
+)
+
+// verificationKey returns the secret a token was signed with, found by the kid in its header.
+// Only HS256 tokens signed with one of the active keys are accepted.
+func verificationKey(keys configuration.JWTKeys, header map[string]interface{}) (interface{}, error) {
+	if header["alg"] != "HS256" {
+		return nil, errors.New("unexpected signing method")
+	}
+	kid, _ := header["kid"].(string)
+	secret, ok := keys.Lookup(kid)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	return secret, nil
+}
@@ -1,10 +1,11 @@
 package authentication
 
 import (
+	"doc-connect/configuration"
+	"fmt"
 	"log"
 	"math/rand"
 	"net/smtp"
-	"os"
 	"time"
 )
 
@@ -29,15 +30,16 @@ func SendOTPByEmail(otp, email string) error {
 	// Constructing the email message with the OTP included
 	message := "Subject: WebPortal OTP\nHey Your OTP is " + otp
 
-	SMTPemail := os.Getenv("Email")
-	SMTPpass := os.Getenv("Password")
+	SMTPemail := configuration.Settings.SMTP.Username
+	SMTPpass := configuration.Settings.SMTP.Password
+	smtpHost := configuration.Settings.SMTP.Host
 
 	// Authenticating with the SMTP server using the sender's credentials
-	auth := smtp.PlainAuth("", SMTPemail, SMTPpass, "smtp.gmail.com")
+	auth := smtp.PlainAuth("", SMTPemail, SMTPpass, smtpHost)
 
 
 	// Sending the email to the specified recipient's address
-	err := smtp.SendMail("smtp.gmail.com:587", auth, SMTPemail, []string{email}, []byte(message))
+	err := smtp.SendMail(fmt.Sprintf("%s:%d", smtpHost, configuration.Settings.SMTP.Port), auth, SMTPemail, []string{email}, []byte(message))
 	if err != nil {
 		log.Println("Error sending email:", err)
 		return err
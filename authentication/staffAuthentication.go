@@ -0,0 +1,53 @@
+package authentication
+
+import (
+	"doc-connect/access"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StaffAuthMiddleware lets active hospital staff through. The account is read on every
+// request, so disabling a staff member applies at once.
+func StaffAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authenticate(c, models.RoleHospitalStaff)
+		if !ok {
+			return
+		}
+
+		var staff models.HospitalStaff
+		if err := configuration.DB.Where("staff_id = ? AND status = ?", claims.Subject, models.StaffActive).First(&staff).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "staff account is not active"})
+			return
+		}
+
+		c.Set("staff_id", staff.StaffID)
+		access.SetPrincipal(c, access.Principal{Role: models.RoleHospitalStaff, HospitalID: staff.HospitalID})
+		c.Next()
+	}
+}
+
+// StaffDoctorMiddleware lets hospital staff act for the doctor of the doctor_id parameter when
+// the doctor works at their hospital, so the doctor routes can be reused for staff
+func StaffDoctorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := access.FromContext(c)
+		err := access.DoctorParam(configuration.DB, principal, c.Param("doctor_id"))
+		if errors.Is(err, access.ErrForbidden) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			return
+		}
+
+		id, _ := strconv.ParseUint(c.Param("doctor_id"), 10, 64)
+		c.Set("doctor_id", uint(id))
+		c.Next()
+	}
+}
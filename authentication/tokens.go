@@ -0,0 +1,310 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrSessionRevoked   = errors.New("session expired or revoked")
+	ErrRefreshReused    = errors.New("refresh token was already used, the session is revoked")
+	ErrSessionNotFound  = errors.New("session not found")
+	errUnknownTokenRole = errors.New("unknown role")
+)
+
+// TokenPair is what a user gets when signing in or refreshing a session: a short lived
+// access token and the refresh token to get the next pair with
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds until the access token expires
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+// sessionsKey is the set of the session ids of a user
+func sessionsKey(role, subject string) string {
+	return "sessions:" + role + ":" + subject
+}
+
+// signingKeys are the keys of the access tokens of a role
+func signingKeys(role string) (configuration.JWTKeys, error) {
+	switch role {
+	case models.RolePatient:
+		return configuration.Settings.JWT.Patient, nil
+	case models.RoleDoctor:
+		return configuration.Settings.JWT.Doctor, nil
+	case models.RoleAdmin:
+		return configuration.Settings.JWT.Admin, nil
+	case models.RoleHospitalStaff:
+		return configuration.Settings.JWT.Staff, nil
+	}
+	return nil, errUnknownTokenRole
+}
+
+// StartSession signs a user in from the device making the request and returns its first tokens
+func StartSession(c *gin.Context, role, subject, name string) (TokenPair, error) {
+	id, err := RandomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	now := time.Now()
+	session := models.Session{
+		ID:          id,
+		Role:        role,
+		Subject:     subject,
+		Name:        name,
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		CreatedAt:   now,
+		RefreshedAt: now,
+		ExpiresAt:   now.Add(configuration.Settings.JWT.RefreshTTL),
+	}
+	refreshToken, err := rotateRefreshToken(&session)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	ctx := context.Background()
+	if _, err := configuration.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(session.ID), data, time.Until(session.ExpiresAt))
+		pipe.SAdd(ctx, sessionsKey(role, subject), session.ID)
+		pipe.Expire(ctx, sessionsKey(role, subject), configuration.Settings.JWT.RefreshTTL)
+		return nil
+	}); err != nil {
+		return TokenPair{}, err
+	}
+	return tokenPair(session, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for new tokens of its session. Every refresh token
+// can be used once; a used one coming back means it leaked, so the session is revoked. Sessions
+// end at the latest when the first refresh token would have expired.
+func RefreshSession(refreshToken string) (TokenPair, error) {
+	id, secret, found := strings.Cut(refreshToken, ".")
+	if !found || id == "" || secret == "" {
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	ctx := context.Background()
+	var session models.Session
+	var newRefreshToken string
+	err := configuration.Client.Watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		if session, err = loadSession(ctx, tx, id); err != nil {
+			return err
+		}
+		if HashToken(secret) != session.RefreshHash {
+			if _, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, sessionKey(session.ID))
+				pipe.SRem(ctx, sessionsKey(session.Role, session.Subject), session.ID)
+				return nil
+			}); err != nil {
+				return err
+			}
+			return ErrRefreshReused
+		}
+
+		if newRefreshToken, err = rotateRefreshToken(&session); err != nil {
+			return err
+		}
+		session.RefreshedAt = time.Now()
+		data, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, sessionKey(session.ID), data, redis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		return err
+	}, sessionKey(id))
+	if errors.Is(err, redis.TxFailedErr) {
+		// The token was used by a concurrent refresh
+		return TokenPair{}, ErrInvalidToken
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return tokenPair(session, newRefreshToken)
+}
+
+// VerifyAccessToken checks an access token of a role and that its session is still active
+func VerifyAccessToken(role, tokenString string) (*models.AuthClaims, error) {
+	keys, err := signingKeys(role)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &models.AuthClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return verificationKey(keys, token.Header)
+	}, jwt.WithExpirationRequired())
+	if err != nil || !token.Valid || claims.Role != role || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	active, err := configuration.Client.Exists(context.Background(), sessionKey(claims.SessionID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if active == 0 {
+		return nil, ErrSessionRevoked
+	}
+	return claims, nil
+}
+
+// ListSessions returns the active sessions of a user, newest first
+func ListSessions(role, subject string) ([]models.Session, error) {
+	ctx := context.Background()
+	ids, err := configuration.Client.SMembers(ctx, sessionsKey(role, subject)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []models.Session{}
+	for _, id := range ids {
+		session, err := loadSession(ctx, configuration.Client, id)
+		if errors.Is(err, ErrSessionRevoked) {
+			// The session expired, forget it
+			configuration.Client.SRem(ctx, sessionsKey(role, subject), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		session.RefreshHash = ""
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// RevokeSession ends a session of a user; its tokens stop working right away
+func RevokeSession(role, subject, id string) error {
+	ctx := context.Background()
+	session, err := loadSession(ctx, configuration.Client, id)
+	if errors.Is(err, ErrSessionRevoked) || (err == nil && (session.Role != role || session.Subject != subject)) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = configuration.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(id))
+		pipe.SRem(ctx, sessionsKey(role, subject), id)
+		return nil
+	})
+	return err
+}
+
+// RevokeAllSessions ends every session of a user, e.g. when their account is disabled
+func RevokeAllSessions(role, subject string) error {
+	ctx := context.Background()
+	ids, err := configuration.Client.SMembers(ctx, sessionsKey(role, subject)).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = configuration.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, sessionKey(id))
+		}
+		pipe.Del(ctx, sessionsKey(role, subject))
+		return nil
+	})
+	return err
+}
+
+func loadSession(ctx context.Context, client redis.Cmdable, id string) (models.Session, error) {
+	var session models.Session
+	data, err := client.Get(ctx, sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return session, ErrSessionRevoked
+	}
+	if err != nil {
+		return session, err
+	}
+	err = json.Unmarshal(data, &session)
+	return session, err
+}
+
+// tokenPair signs a new access token for a session
+func tokenPair(session models.Session, refreshToken string) (TokenPair, error) {
+	keys, err := signingKeys(session.Role)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	jti, err := RandomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+	ttl := configuration.Settings.JWT.AccessTTL
+	claims := &models.AuthClaims{
+		Role:      session.Role,
+		SessionID: session.ID,
+		Name:      session.Name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   session.Subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	key := keys.Signing()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	accessToken, err := token.SignedString(key.Secret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: int64(ttl.Seconds())}, nil
+}
+
+// rotateRefreshToken makes a new refresh token the only one the session accepts
+func rotateRefreshToken(session *models.Session) (string, error) {
+	secret, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+	session.RefreshHash = HashToken(secret)
+	return session.ID + "." + secret, nil
+}
+
+// RandomToken returns a random secret that can't be guessed
+func RandomToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// HashToken is what is stored of a secret token, so the tokens can't be read from storage
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
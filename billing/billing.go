@@ -0,0 +1,69 @@
+// Package billing prices invoice line items and totals invoices. Amounts are exact minor
+// units, rounded half up: tax per line to the paisa, the invoice total to the rupee when
+// rounding to rupees.
+package billing
+
+import (
+	"doc-connect/models"
+	"doc-connect/money"
+)
+
+// PriceItem computes the tax and amount of a line item. The discount can't exceed the
+// price of the line.
+func PriceItem(item *models.InvoiceItem) {
+	if item.Quantity <= 0 {
+		item.Quantity = 1
+	}
+
+	gross := item.UnitPrice * money.Amount(item.Quantity)
+	if item.Discount > gross {
+		item.Discount = gross
+	}
+	taxable := gross - item.Discount
+
+	item.TaxAmount = taxable.Percent(item.TaxRate)
+	item.Amount = taxable + item.TaxAmount
+}
+
+// Total prices the items of an invoice and sets its subtotal, discount, tax and total
+func Total(invoice *models.Invoice, roundToRupee bool) {
+	var subtotal, discount, tax, total money.Amount
+	for i := range invoice.Items {
+		item := &invoice.Items[i]
+		PriceItem(item)
+		subtotal += item.UnitPrice * money.Amount(item.Quantity)
+		discount += item.Discount
+		tax += item.TaxAmount
+		total += item.Amount
+	}
+
+	rounded := total
+	if roundToRupee {
+		rounded = (total + 50) / 100 * 100
+	}
+
+	invoice.Subtotal = subtotal
+	invoice.DiscountAmount = discount
+	invoice.TaxAmount = tax
+	invoice.RoundingAdjustment = rounded - total
+	invoice.TotalAmount = rounded
+}
+
+// SplitGST splits the GST of an invoice into its CGST and SGST halves
+func SplitGST(tax money.Amount) (money.Amount, money.Amount) {
+	cgst := tax / 2
+	return cgst, tax - cgst
+}
+
+// DoctorEarnings is the part of an invoice that is the doctor's: its lines after discount and
+// before tax, except the platform fee
+func DoctorEarnings(invoice models.Invoice) money.Amount {
+	var earnings money.Amount
+	for _, item := range invoice.Items {
+		if item.Kind == models.InvoiceItemPlatformFee {
+			continue
+		}
+		earnings += item.Amount - item.TaxAmount
+	}
+	return earnings
+}
@@ -0,0 +1,22 @@
+// Command razorpayfake runs the in-memory Razorpay API for local development.
+// Point the server at it with RAZORPAY_BASE_URL=http://localhost:8090.
+package main
+
+import (
+	"doc-connect/razorpayfake"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := os.Getenv("RAZORPAY_FAKE_ADDR")
+	if addr == "" {
+		addr = ":8090"
+	}
+
+	log.Println("Fake Razorpay API listening on", addr)
+	if err := http.ListenAndServe(addr, razorpayfake.New().Handler()); err != nil {
+		log.Fatal(err)
+	}
+}
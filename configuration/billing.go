@@ -0,0 +1,48 @@
+package configuration
+
+import (
+	"doc-connect/models"
+	"doc-connect/money"
+	"strings"
+)
+
+// Rounding rules for invoice totals
+const (
+	RoundToRupee = "rupee"
+	RoundToPaise = "paise"
+)
+
+// BillingConfig holds the fees, taxes and rounding of invoices
+type BillingConfig struct {
+	PlatformFee money.Amount
+	TaxRates    map[string]float64 // GST in percent by invoice item kind
+	Rounding    string
+}
+
+func loadBilling(env *envReader) BillingConfig {
+	config := BillingConfig{
+		PlatformFee: money.FromMajor(env.float("PLATFORM_FEE", 50)),
+		TaxRates:    map[string]float64{},
+		Rounding:    env.oneOf("INVOICE_ROUNDING", RoundToRupee, RoundToPaise),
+	}
+	for _, kind := range []string{models.InvoiceItemConsultation, models.InvoiceItemPlatformFee, models.InvoiceItemLabTest, models.InvoiceItemProcedure} {
+		config.TaxRates[kind] = env.percent("TAX_RATE_"+strings.ToUpper(kind), 0)
+	}
+	return config
+}
+
+// PlatformFee is the booking fee charged on every appointment invoice
+func PlatformFee() money.Amount {
+	return Settings.Billing.PlatformFee
+}
+
+// TaxRate is the GST rate in percent charged on invoice items of a kind, read from
+// TAX_RATE_<KIND> (e.g. TAX_RATE_PLATFORM_FEE). Items are tax free unless configured.
+func TaxRate(kind string) float64 {
+	return Settings.Billing.TaxRates[kind]
+}
+
+// InvoiceRounding is how invoice totals are rounded, to whole rupees unless INVOICE_ROUNDING is paise
+func InvoiceRounding() string {
+	return Settings.Billing.Rounding
+}
@@ -0,0 +1,55 @@
+package configuration
+
+import (
+	"time"
+)
+
+// BookingConfig holds the booking windows and how often booking jobs run
+type BookingConfig struct {
+	PaymentHoldDuration   time.Duration
+	InvoiceExpiryInterval time.Duration
+	RescheduleCutoff      time.Duration
+	WaitlistClaimWindow   time.Duration
+	WaitlistOfferInterval time.Duration
+}
+
+func loadBooking(env *envReader) BookingConfig {
+	return BookingConfig{
+		PaymentHoldDuration:   env.duration("PAYMENT_HOLD_DURATION", 24*time.Hour),
+		InvoiceExpiryInterval: env.duration("INVOICE_EXPIRY_INTERVAL", 5*time.Minute),
+		RescheduleCutoff:      env.duration("RESCHEDULE_CUTOFF", 12*time.Hour),
+		WaitlistClaimWindow:   env.duration("WAITLIST_CLAIM_WINDOW", 30*time.Minute),
+		WaitlistOfferInterval: env.duration("WAITLIST_OFFER_INTERVAL", time.Minute),
+	}
+}
+
+// PaymentHoldDuration is how long a pending booking holds its slot waiting for payment.
+// The invoice of the booking is due at the end of the same window.
+func PaymentHoldDuration() time.Duration {
+	return Settings.Booking.PaymentHoldDuration
+}
+
+// InvoiceExpiryInterval is how often overdue invoices are expired
+func InvoiceExpiryInterval() time.Duration {
+	return Settings.Booking.InvoiceExpiryInterval
+}
+
+// RescheduleCutoff is how long before the booked slot an appointment can still be rescheduled
+func RescheduleCutoff() time.Duration {
+	return Settings.Booking.RescheduleCutoff
+}
+
+// WaitlistClaimWindow is how long a waitlisted patient has to claim an offered slot
+func WaitlistClaimWindow() time.Duration {
+	return Settings.Booking.WaitlistClaimWindow
+}
+
+// WaitlistOfferInterval is how often unclaimed waitlist offers are moved down the queue
+func WaitlistOfferInterval() time.Duration {
+	return Settings.Booking.WaitlistOfferInterval
+}
+
+// AppBaseURL is the public address of the server used in links sent by email
+func AppBaseURL() string {
+	return Settings.Server.BaseURL
+}
@@ -0,0 +1,251 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config holds every setting of the server. It is loaded once at startup by Load.
+type Config struct {
+	DB       DBConfig
+	Server   ServerConfig
+	Redis    RedisConfig
+	SMTP     SMTPConfig
+	Twilio   TwilioConfig
+	Payments PaymentsConfig
+	JWT      JWTConfig
+	Features FeaturesConfig
+	Booking  BookingConfig
+	Billing  BillingConfig
+	Wallet   WalletConfig
+	Payouts  PayoutsConfig
+}
+
+// DBConfig is the connection to the postgres database
+type DBConfig struct {
+	DSN string
+}
+
+// ServerConfig is where the server listens and how it is reached from outside
+type ServerConfig struct {
+	Port    int
+	BaseURL string // public address used in links sent by email
+}
+
+// RedisConfig is the connection to the redis server
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// SMTPConfig is the mail server emails are sent through
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // also the sender address
+	Password string
+}
+
+// TwilioConfig is the Twilio account SMS OTPs are sent with
+type TwilioConfig struct {
+	AccountSID  string
+	AuthToken   string
+	ServiceID   string
+	PhoneNumber string
+}
+
+// FeaturesConfig turns optional parts of the server on or off
+type FeaturesConfig struct {
+	Jobs               bool // run the background jobs, only one instance needs to
+	EmailNotifications bool // send notification, invoice and prescription emails
+}
+
+// Settings is the configuration the server was started with
+var Settings Config
+
+// Load reads the configuration from the environment, after loading the env file named by
+// CONFIG_FILE (.env by default) into it. Variables already set in the environment win over
+// the file. Every invalid or missing setting is reported at once.
+func Load() error {
+	file := os.Getenv("CONFIG_FILE")
+	if file == "" {
+		if _, err := os.Stat(".env"); err == nil {
+			file = ".env"
+		}
+	}
+	if file != "" {
+		if err := godotenv.Load(file); err != nil {
+			return fmt.Errorf("failed to load config file %s: %w", file, err)
+		}
+	}
+
+	env := &envReader{}
+	config := Config{
+		DB: DBConfig{
+			DSN: env.required("DB"),
+		},
+		Server: ServerConfig{
+			Port:    env.int("PORT", 8080),
+			BaseURL: strings.TrimRight(env.string("APP_BASE_URL", ""), "/"),
+		},
+		Redis: RedisConfig{
+			Addr:     env.string("REDIS_ADDR", "localhost:6379"),
+			Password: env.string("REDIS_PASSWORD", ""),
+			DB:       env.int("REDIS_DB", 0),
+		},
+		SMTP: SMTPConfig{
+			Host:     env.string("SMTP_HOST", "smtp.gmail.com"),
+			Port:     env.int("SMTP_PORT", 587),
+			Username: env.required("Email"),
+			Password: env.required("Password"),
+		},
+		Twilio: TwilioConfig{
+			AccountSID:  env.required("TWILIO_ACCOUNT_SID"),
+			AuthToken:   env.required("TWILIO_AUTHTOKEN"),
+			ServiceID:   env.required("TWILIO_SERVIES_ID"),
+			PhoneNumber: env.string("TWILIO_PHONENUMBER", ""),
+		},
+		Payments: loadPayments(env),
+		JWT: JWTConfig{
+			Patient:    env.jwtKeys("JWT_PATIENT_KEYS"),
+			Doctor:     env.jwtKeys("JWT_DOCTOR_KEYS"),
+			Admin:      env.jwtKeys("JWT_ADMIN_KEYS"),
+			Staff:      env.jwtKeys("JWT_STAFF_KEYS"),
+			AccessTTL:  env.duration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTTL: env.duration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		},
+		Features: FeaturesConfig{
+			Jobs:               env.bool("JOBS_ENABLED", true),
+			EmailNotifications: env.bool("EMAIL_NOTIFICATIONS", true),
+		},
+		Booking: loadBooking(env),
+		Billing: loadBilling(env),
+		Wallet:  loadWallet(env),
+		Payouts: loadPayouts(env),
+	}
+	if config.Server.BaseURL == "" {
+		config.Server.BaseURL = fmt.Sprintf("http://localhost:%d", config.Server.Port)
+	}
+	if config.JWT.AccessTTL >= config.JWT.RefreshTTL {
+		env.fail("ACCESS_TOKEN_TTL", "must be shorter than REFRESH_TOKEN_TTL")
+	}
+	if config.Wallet.TopUpMin > config.Wallet.TopUpMax {
+		env.fail("WALLET_TOPUP_MIN", "must not be more than WALLET_TOPUP_MAX")
+	}
+	if config.Wallet.TopUpMax > config.Wallet.MaxBalance {
+		env.fail("WALLET_TOPUP_MAX", "must not be more than WALLET_MAX_BALANCE")
+	}
+
+	if err := errors.Join(env.errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	Settings = config
+	return nil
+}
+
+// envReader reads settings from the environment and collects what is wrong with them
+type envReader struct {
+	errs []error
+}
+
+func (env *envReader) fail(key, reason string) {
+	env.errs = append(env.errs, fmt.Errorf("%s %s", key, reason))
+}
+
+func (env *envReader) string(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (env *envReader) required(key string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		env.fail(key, "is required")
+	}
+	return value
+}
+
+// oneOf reads a setting that must be one of a few values, the first being the default
+func (env *envReader) oneOf(key string, values ...string) string {
+	value := env.string(key, values[0])
+	for _, allowed := range values {
+		if value == allowed {
+			return value
+		}
+	}
+	env.fail(key, "must be one of "+strings.Join(values, ", "))
+	return values[0]
+}
+
+func (env *envReader) int(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		env.fail(key, fmt.Sprintf("must be a non-negative integer, got %q", value))
+		return fallback
+	}
+	return number
+}
+
+// float reads a non-negative number
+func (env *envReader) float(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		env.fail(key, fmt.Sprintf("must be a non-negative number, got %q", value))
+		return fallback
+	}
+	return number
+}
+
+// percent reads a number between 0 and 100
+func (env *envReader) percent(key string, fallback float64) float64 {
+	number := env.float(key, fallback)
+	if number > 100 {
+		env.fail(key, "must be at most 100")
+		return fallback
+	}
+	return number
+}
+
+func (env *envReader) bool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		env.fail(key, fmt.Sprintf("must be true or false, got %q", value))
+		return fallback
+	}
+	return enabled
+}
+
+// duration reads a positive duration such as "30m" or "24h"
+func (env *envReader) duration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		env.fail(key, fmt.Sprintf("must be a positive duration such as 30m, got %q", value))
+		return fallback
+	}
+	return duration
+}
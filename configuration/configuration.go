@@ -2,10 +2,12 @@ package configuration
 
 import (
 	"doc-connect/models"
+	"doc-connect/refundpolicy"
+	"fmt"
 	"log"
-	"os"
+	"slices"
 
-	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -15,30 +17,301 @@ var DB *gorm.DB
 
 // initializing db connection
 func ConfigDB() {
-
-	err1 := godotenv.Load(".env")
-	if err1 != nil {
-		log.Fatal("Error loading .env file")
-	}
-	dsn := os.Getenv("DB")
 	var err error
-
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(Settings.DB.DSN), &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic("Failed to connect to the database")
 	}
 
+	migrateRefundPaymentColumn()
+	migrateMoneyColumns()
+
 	DB.AutoMigrate(
 		&models.Appointment{},
 		&models.Doctor{},
 		&models.Hospital{},
 		&models.Patient{},
 		&models.Invoice{},
-		&models.RazorPay{},
+		&models.InvoiceItem{},
+		&models.InvoicePayment{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.PaymentAttempt{},
 		&models.Prescription{},
 		&models.Admin{},
+		&models.HospitalStaff{},
 		&models.DoctorAvailability{},
+		&models.DoctorWeeklySchedule{},
+		&models.DoctorBlackout{},
+		&models.AvailabilityWindow{},
+		&models.JobRun{},
+		&models.AppointmentReschedule{},
+		&models.WaitlistEntry{},
+		&models.AppointmentTransition{},
+		&models.BookingPolicy{},
+		&models.RefundRule{},
+		&models.Refund{},
+		&models.WebhookEvent{},
 		&models.Wallet{},
+		&models.WalletTransaction{},
+		&models.WalletTopUp{},
+		&models.Commission{},
+		&models.Payout{},
+		&models.PayoutItem{},
 	)
 
+	migrateSlotReservations()
+	migratePayoutItems()
+	migrateRefundedAmounts()
+	migrateStatuses()
+	migrateRazorPayments()
+	migrateInvoiceItems()
+	migrateInvoicePayments()
+	migrateWalletLedger()
+	migrateAdminPasswords()
+	seedRefundRules()
+}
+
+// migrateRefundPaymentColumn renames the Razorpay specific payment column of refunds
+// before the refunds table is migrated
+func migrateRefundPaymentColumn() {
+	if DB.Migrator().HasColumn(&models.Refund{}, "razor_payment_id") && !DB.Migrator().HasColumn(&models.Refund{}, "provider_payment_id") {
+		if err := DB.Migrator().RenameColumn(&models.Refund{}, "razor_payment_id", "provider_payment_id"); err != nil {
+			log.Println("Failed to rename refund payment column:", err)
+		}
+		if err := DB.Exec(`UPDATE refunds SET provider = 'razorpay' WHERE provider_payment_id <> ''`).Error; err != nil {
+			log.Println("Failed to set refund provider:", err)
+		}
+	}
+}
+
+// moneyColumns are the columns holding amounts of money, stored as integer paise
+var moneyColumns = map[string][]string{
+	"invoices":         {"total_amount", "subtotal", "discount_amount", "tax_amount", "rounding_adjustment"},
+	"invoice_items":    {"unit_price", "discount", "tax_amount", "amount"},
+	"wallets":          {"amount"},
+	"payment_attempts": {"amount"},
+	"refunds":          {"amount"},
+}
+
+// migrateMoneyColumns converts amounts stored as decimal rupees into integer paise before the
+// tables are migrated. Columns that are already integers are left alone.
+func migrateMoneyColumns() {
+	for table, columns := range moneyColumns {
+		if !DB.Migrator().HasTable(table) {
+			continue
+		}
+		columnTypes, err := DB.Migrator().ColumnTypes(table)
+		if err != nil {
+			log.Printf("Failed to read the columns of %s: %v\n", table, err)
+			continue
+		}
+
+		for _, columnType := range columnTypes {
+			if !slices.Contains(columns, columnType.Name()) || columnType.DatabaseTypeName() == "int8" {
+				continue
+			}
+			column := columnType.Name()
+			if err := DB.Exec(fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE bigint USING ROUND(%s * 100)`, table, column, column)).Error; err != nil {
+				log.Printf("Failed to convert %s.%s to paise: %v\n", table, column, err)
+			}
+		}
+	}
+}
+
+// migrateRazorPayments copies the orders of the former Razorpay-only payment table into
+// payment attempts. The old table is left in place.
+func migrateRazorPayments() {
+	if !DB.Migrator().HasTable("razor_pays") {
+		return
+	}
+	// Payment ids that don't start with pay_ are placeholders of orders that were never paid
+	if err := DB.Exec(`INSERT INTO payment_attempts (invoice_id, provider, provider_order_id, provider_payment_id, amount, currency, status, created_at, updated_at)
+		SELECT invoice_id, 'razorpay', razor_payorder_id,
+			CASE WHEN razor_payment_id LIKE 'pay\_%' THEN razor_payment_id ELSE '' END,
+			ROUND(amount_paid * 100), 'INR', COALESCE(NULLIF(status, ''), 'created'), NOW(), NOW()
+		FROM razor_pays
+		WHERE razor_payorder_id <> ''
+		ON CONFLICT (provider, provider_order_id) DO NOTHING`).Error; err != nil {
+		log.Println("Failed to migrate Razorpay payments:", err)
+	}
+}
+
+// migrateInvoiceItems itemises invoices created before invoices had line items. Their total
+// was the consultation fee plus a platform fee of 50 rupees (5000 paise), without tax.
+func migrateInvoiceItems() {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		legacy := `FROM invoices i WHERE NOT EXISTS (SELECT 1 FROM invoice_items it WHERE it.invoice_id = i.invoice_id)`
+		if err := tx.Exec(`INSERT INTO invoice_items (invoice_id, kind, description, quantity, unit_price, discount, tax_rate, tax_amount, amount, created_at)
+			SELECT invoice_id, 'platform_fee', 'Platform fee', 1, 5000, 0, 0, 0, 5000, created_at ` + legacy + ` AND i.total_amount >= 5000`).Error; err != nil {
+			return err
+		}
+		// Every invoice without items but the ones just given a platform fee
+		if err := tx.Exec(`INSERT INTO invoice_items (invoice_id, kind, description, quantity, unit_price, discount, tax_rate, tax_amount, amount, created_at)
+			SELECT i.invoice_id, 'consultation', 'Consultation', 1, i.total_amount - COALESCE(f.amount, 0), 0, 0, 0, i.total_amount - COALESCE(f.amount, 0), i.created_at
+			FROM invoices i LEFT JOIN invoice_items f ON f.invoice_id = i.invoice_id AND f.kind = 'platform_fee'
+			WHERE NOT EXISTS (SELECT 1 FROM invoice_items it WHERE it.invoice_id = i.invoice_id AND it.kind = 'consultation')`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE invoices SET subtotal = total_amount WHERE subtotal = 0 AND discount_amount = 0 AND tax_amount = 0`).Error
+	})
+	if err != nil {
+		log.Println("Failed to itemise invoices:", err)
+	}
+}
+
+// migrateInvoicePayments records the payment of invoices paid before invoices could be paid
+// in parts
+func migrateInvoicePayments() {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		settled := []string{models.InvoicePaid, models.InvoiceRefunded}
+		if err := tx.Exec(`UPDATE invoices SET amount_paid = total_amount WHERE payment_status IN ? AND amount_paid = 0`, settled).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO invoice_payments (invoice_id, method, amount, currency, status, created_at, updated_at)
+			SELECT i.invoice_id, i.payment_method, i.amount_paid, i.currency, ?, i.updated_at, i.updated_at
+			FROM invoices i
+			WHERE i.payment_status IN ? AND NOT EXISTS (SELECT 1 FROM invoice_payments p WHERE p.invoice_id = i.invoice_id)`,
+			models.InvoicePaymentApplied, settled).Error
+	})
+	if err != nil {
+		log.Println("Failed to record invoice payments:", err)
+	}
+}
+
+// migrateWalletLedger opens the ledger of wallets that had a balance before wallet transactions
+// were recorded, so their ledger sums to their balance
+func migrateWalletLedger() {
+	if err := DB.Exec(`INSERT INTO wallet_transactions (user_id, type, reason, description, invoice_id, appointment_id, amount, currency, balance_after, idempotency_key, created_at)
+		SELECT w.user_id, 'credit', 'opening_balance', 'Opening balance', 0, 0, w.amount, w.currency, w.amount, 'opening:' || w.user_id, NOW()
+		FROM wallets w
+		WHERE w.amount > 0 AND NOT EXISTS (SELECT 1 FROM wallet_transactions t WHERE t.user_id = w.user_id)`).Error; err != nil {
+		log.Println("Failed to open wallet ledgers:", err)
+	}
+}
+
+// migrateAdminPasswords hashes the passwords of admins that were stored in plain text, which
+// admin login no longer accepts
+func migrateAdminPasswords() {
+	var admins []models.Admin
+	if err := DB.Where("password <> '' AND password NOT LIKE '$2%'").Find(&admins).Error; err != nil {
+		log.Println("Failed to find plain text admin passwords:", err)
+		return
+	}
+	for _, admin := range admins {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(admin.Password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Println("Failed to hash admin password:", err)
+			continue
+		}
+		if err := DB.Model(&admin).Update("password", string(hashedPassword)).Error; err != nil {
+			log.Println("Failed to hash admin password:", err)
+		}
+	}
+}
+
+// seedRefundRules adds the default cancellation policy when no refund rules exist yet
+func seedRefundRules() {
+	var count int64
+	if err := DB.Model(&models.RefundRule{}).Count(&count).Error; err != nil {
+		log.Println("Failed to count refund rules:", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	rules := refundpolicy.DefaultRules()
+	if err := DB.Create(&rules).Error; err != nil {
+		log.Println("Failed to seed refund rules:", err)
+	}
+}
+
+// migratePayoutItems drops the index that allowed one payout item per invoice, now that a
+// refunded invoice also gets an adjustment item
+func migratePayoutItems() {
+	if DB.Migrator().HasIndex(&models.PayoutItem{}, "idx_payout_items_invoice_id") {
+		if err := DB.Migrator().DropIndex(&models.PayoutItem{}, "idx_payout_items_invoice_id"); err != nil {
+			log.Println("Failed to drop payout item invoice index:", err)
+		}
+	}
+}
+
+// migrateRefundedAmounts backfills how much of the refunded invoices stored before refunded
+// amounts were kept was given back, from their refunds
+func migrateRefundedAmounts() {
+	if err := DB.Exec(`UPDATE invoices SET amount_refunded = LEAST(total_amount,
+		(SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE refunds.invoice_id = invoices.invoice_id))
+		WHERE payment_status = 'Refunded' AND amount_refunded = 0`).Error; err != nil {
+		log.Println("Failed to backfill refunded amounts:", err)
+	}
+}
+
+// migrateStatuses rewrites the refunded invoices stored before invoice statuses were
+// capitalized consistently
+func migrateStatuses() {
+	if err := DB.Exec(`UPDATE invoices SET payment_status = 'Refunded' WHERE payment_status = 'refunded'`).Error; err != nil {
+		log.Println("Failed to migrate refunded invoices:", err)
+	}
+}
+
+// migrateSlotReservations enforces at the database level that a slot has only one live booking.
+// Cancelled bookings don't take part in the index, so a cancelled or expired slot can be booked again.
+func migrateSlotReservations() {
+	// Pending bookings created before holds existed hold their slot until the invoice is due
+	if err := DB.Exec(`UPDATE appointments SET hold_expires_at = invoices.payment_due_date
+		FROM invoices
+		WHERE invoices.appointment_id = appointments.appointment_id
+		AND appointments.booking_status = 'pending' AND appointments.hold_expires_at IS NULL`).Error; err != nil {
+		log.Println("Failed to backfill appointment holds:", err)
+	}
+
+	cancelDuplicateBookings()
+
+	// Bookings rely on the index to never double book a slot, so don't start without it
+	if err := DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_live_slot
+		ON appointments (doctor_id, appointment_date, appointment_time_slot)
+		WHERE booking_status <> 'cancelled'`).Error; err != nil {
+		log.Fatal("Failed to create live slot index, a slot still has more than one live booking: ", err)
+	}
+}
+
+// cancelDuplicateBookings expires the pending bookings of a slot that already has a live booking
+// from before the live slot index existed. The booking kept is the oldest one past pending, or
+// the oldest pending one when all of them are pending.
+func cancelDuplicateBookings() {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var duplicates []int
+		if err := tx.Raw(`SELECT appointment_id FROM (
+				SELECT appointment_id, booking_status, ROW_NUMBER() OVER (
+					PARTITION BY doctor_id, appointment_date, appointment_time_slot
+					ORDER BY booking_status = 'pending', appointment_id) AS n
+				FROM appointments WHERE booking_status <> 'cancelled') ranked
+			WHERE n > 1 AND booking_status = 'pending'`).Scan(&duplicates).Error; err != nil {
+			return err
+		}
+		if len(duplicates) == 0 {
+			return nil
+		}
+
+		if err := tx.Exec(`INSERT INTO appointment_transitions (appointment_id, from_status, to_status, from_payment_status, to_payment_status, actor, reason, created_at)
+			SELECT appointment_id, booking_status, ?, payment_status, ?, 'system', 'duplicate booking of the slot', NOW()
+			FROM appointments WHERE appointment_id IN ?`,
+			models.BookingCancelled, models.AppointmentPaymentExpired, duplicates).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE appointments SET booking_status = ?, payment_status = ?, hold_expires_at = NULL WHERE appointment_id IN ?`,
+			models.BookingCancelled, models.AppointmentPaymentExpired, duplicates).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE invoices SET payment_status = ? WHERE appointment_id IN ? AND payment_status = ?`,
+			models.InvoiceExpired, duplicates, models.InvoicePending).Error; err != nil {
+			return err
+		}
+		log.Printf("Cancelled %d duplicate pending bookings\n", len(duplicates))
+		return nil
+	})
+	if err != nil {
+		log.Println("Failed to cancel duplicate bookings:", err)
+	}
 }
@@ -0,0 +1,73 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// minJWTSecretLength is the shortest HMAC secret accepted for signing tokens
+const minJWTSecretLength = 32
+
+// JWTConfig holds the signing keys of the tokens of each kind of user and how long tokens last
+type JWTConfig struct {
+	Patient    JWTKeys
+	Doctor     JWTKeys
+	Admin      JWTKeys
+	Staff      JWTKeys // of hospital staff
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration // also the longest a session lasts
+}
+
+// JWTKey is an HMAC secret identified by the kid header of the tokens signed with it
+type JWTKey struct {
+	ID     string
+	Secret []byte
+}
+
+// JWTKeys are the active keys of a kind of token. New tokens are signed with the first key,
+// tokens signed with any of them are accepted, so a key can be rotated by putting a new key
+// first and removing the old one once its tokens have expired.
+type JWTKeys []JWTKey
+
+// Signing is the key new tokens are signed with
+func (keys JWTKeys) Signing() JWTKey {
+	return keys[0]
+}
+
+// Lookup returns the secret of the key with the given kid
+func (keys JWTKeys) Lookup(kid string) ([]byte, bool) {
+	for _, key := range keys {
+		if key.ID == kid {
+			return key.Secret, true
+		}
+	}
+	return nil, false
+}
+
+// jwtKeys reads a comma separated list of kid:secret pairs, the signing key first
+func (env *envReader) jwtKeys(key string) JWTKeys {
+	value := env.required(key)
+	if value == "" {
+		return nil
+	}
+
+	var keys JWTKeys
+	for _, pair := range strings.Split(value, ",") {
+		kid, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		switch {
+		case !found || kid == "":
+			env.fail(key, "must be a comma separated list of kid:secret pairs")
+			return nil
+		case len(secret) < minJWTSecretLength:
+			env.fail(key, fmt.Sprintf("secret of kid %s must be at least %d characters", kid, minJWTSecretLength))
+			return nil
+		}
+		if _, duplicated := keys.Lookup(kid); duplicated {
+			env.fail(key, fmt.Sprintf("has kid %s more than once", kid))
+			return nil
+		}
+		keys = append(keys, JWTKey{ID: kid, Secret: []byte(secret)})
+	}
+	return keys
+}
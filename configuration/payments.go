@@ -0,0 +1,61 @@
+package configuration
+
+import (
+	"doc-connect/payments"
+	"strings"
+	"time"
+)
+
+// PaymentProvider is the payment gateway invoices are paid online with
+var PaymentProvider payments.Provider
+
+// PaymentsConfig holds the payment gateway settings
+type PaymentsConfig struct {
+	Provider                string // razorpay or fake
+	RazorpayKeyID           string
+	RazorpayKeySecret       string
+	RazorpayWebhookSecret   string
+	RazorpayBaseURL         string // overrides the Razorpay API address, e.g. to use the local fake API
+	RefundReconcileInterval time.Duration
+}
+
+func loadPayments(env *envReader) PaymentsConfig {
+	config := PaymentsConfig{
+		Provider:                env.oneOf("PAYMENT_PROVIDER", "razorpay", "fake"),
+		RazorpayBaseURL:         strings.TrimRight(env.string("RAZORPAY_BASE_URL", ""), "/"),
+		RefundReconcileInterval: env.duration("REFUND_RECONCILE_INTERVAL", 10*time.Minute),
+	}
+	// The fake provider keeps everything in memory and needs no keys
+	if config.Provider == "razorpay" {
+		config.RazorpayKeyID = env.required("RazorPay_key_id")
+		config.RazorpayKeySecret = env.required("RazorPay_key_secret")
+		config.RazorpayWebhookSecret = env.required("RAZORPAY_WEBHOOK_SECRET")
+	}
+	return config
+}
+
+// InitPayments sets up the payment provider chosen with PAYMENT_PROVIDER, razorpay by default.
+// The fake provider keeps everything in memory for local development.
+func InitPayments() {
+	switch Settings.Payments.Provider {
+	case "fake":
+		PaymentProvider = payments.NewFake()
+	default:
+		PaymentProvider = payments.NewRazorpay(Settings.Payments.RazorpayKeyID, RazorpayKeySecret(), Settings.Payments.RazorpayBaseURL)
+	}
+}
+
+// RazorpayKeySecret is the API secret used to verify checkout payment signatures
+func RazorpayKeySecret() string {
+	return Settings.Payments.RazorpayKeySecret
+}
+
+// RazorpayWebhookSecret is the secret configured for the Razorpay webhook
+func RazorpayWebhookSecret() string {
+	return Settings.Payments.RazorpayWebhookSecret
+}
+
+// RefundReconcileInterval is how often pending gateway refunds are checked with Razorpay
+func RefundReconcileInterval() time.Duration {
+	return Settings.Payments.RefundReconcileInterval
+}
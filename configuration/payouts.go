@@ -0,0 +1,42 @@
+package configuration
+
+import (
+	"time"
+)
+
+// Lengths of a payout period
+const (
+	PayoutWeekly  = "weekly"
+	PayoutMonthly = "monthly"
+)
+
+// PayoutsConfig holds the platform commission and the payout schedule of doctors
+type PayoutsConfig struct {
+	PlatformCommission float64
+	Period             string
+	StatementInterval  time.Duration
+}
+
+func loadPayouts(env *envReader) PayoutsConfig {
+	return PayoutsConfig{
+		PlatformCommission: env.percent("PLATFORM_COMMISSION", 10),
+		Period:             env.oneOf("PAYOUT_PERIOD", PayoutMonthly, PayoutWeekly),
+		StatementInterval:  env.duration("PAYOUT_STATEMENT_INTERVAL", 6*time.Hour),
+	}
+}
+
+// PlatformCommission is the commission in percent kept from doctors without a commission of
+// their own or of their hospital
+func PlatformCommission() float64 {
+	return Settings.Payouts.PlatformCommission
+}
+
+// PayoutPeriod is the period doctor payout statements cover, monthly unless PAYOUT_PERIOD is weekly
+func PayoutPeriod() string {
+	return Settings.Payouts.Period
+}
+
+// PayoutStatementInterval is how often payout statements of ended periods are generated
+func PayoutStatementInterval() time.Duration {
+	return Settings.Payouts.StatementInterval
+}
@@ -20,9 +20,9 @@ func InitRedis() {
 	for i := 0; i < MaxRetries; i++ {
 		Client = redis.NewClient(&redis.Options{
 			Network:  "tcp",
-			Addr:     "localhost:6379",
-			Password: "", // no password set
-			DB:       0,  // use default DB
+			Addr:     Settings.Redis.Addr,
+			Password: Settings.Redis.Password,
+			DB:       Settings.Redis.DB,
 		})
 
 		_, err = Client.Ping(ctx).Result()
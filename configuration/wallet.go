@@ -0,0 +1,51 @@
+package configuration
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// WalletConfig holds the wallet limits and how often wallets are reconciled
+type WalletConfig struct {
+	ReconcileInterval time.Duration
+	TopUpMin          money.Amount
+	TopUpMax          money.Amount
+	MaxBalance        money.Amount
+	CheckoutWindow    time.Duration // how long a top-up can be paid after it is created
+}
+
+func loadWallet(env *envReader) WalletConfig {
+	return WalletConfig{
+		ReconcileInterval: env.duration("WALLET_RECONCILE_INTERVAL", time.Hour),
+		TopUpMin:          money.FromMajor(env.float("WALLET_TOPUP_MIN", 100)),
+		TopUpMax:          money.FromMajor(env.float("WALLET_TOPUP_MAX", 10000)),
+		MaxBalance:        money.FromMajor(env.float("WALLET_MAX_BALANCE", 50000)),
+		CheckoutWindow:    env.duration("WALLET_TOPUP_CHECKOUT_WINDOW", 30*time.Minute),
+	}
+}
+
+// WalletReconcileInterval is how often wallet balances are checked against the wallet ledger
+func WalletReconcileInterval() time.Duration {
+	return Settings.Wallet.ReconcileInterval
+}
+
+// WalletTopUpMin is the smallest amount a wallet can be topped up with
+func WalletTopUpMin() money.Amount {
+	return Settings.Wallet.TopUpMin
+}
+
+// WalletTopUpMax is the largest amount a wallet can be topped up with at once
+func WalletTopUpMax() money.Amount {
+	return Settings.Wallet.TopUpMax
+}
+
+// WalletMaxBalance is the most money a wallet can hold after a top-up
+func WalletMaxBalance() money.Amount {
+	return Settings.Wallet.MaxBalance
+}
+
+// WalletTopUpCheckoutWindow is how long a wallet top-up can be paid after it is created.
+// Older unpaid top-ups no longer count towards the maximum balance.
+func WalletTopUpCheckoutWindow() time.Duration {
+	return Settings.Wallet.CheckoutWindow
+}
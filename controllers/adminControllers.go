@@ -12,49 +12,42 @@ import (
 
 // Amin login
 func AdminLogin(c *gin.Context) {
-	var admin models.Admin
-	if err := c.BindJSON(&admin); err != nil {
+	var loginRequest struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.BindJSON(&loginRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	var dbAdmin models.Admin
-	if err := configuration.DB.Where("username = ?", admin.Username).First(&dbAdmin).Error; err != nil {
+	if err := configuration.DB.Where("username = ?", loginRequest.Username).First(&dbAdmin).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
 
-	if len(dbAdmin.Password) > 0 && dbAdmin.Password[0] == '$' {
-		if err := bcrypt.CompareHashAndPassword([]byte(dbAdmin.Password), []byte(admin.Password)); err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"erroe": "Invalid username or password"})
-			return
-		}
-	} else {
-		if dbAdmin.Password != admin.Password {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
-			return
-		}
-
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(admin.Password), bcrypt.DefaultCost)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-			return
-		}
-		dbAdmin.Password = string(hashedPassword)
-		if err := configuration.DB.Save(&dbAdmin).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
-			return
-		}
+	if err := bcrypt.CompareHashAndPassword([]byte(dbAdmin.Password), []byte(loginRequest.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+	if dbAdmin.Status != models.AdminActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin account is " + dbAdmin.Status})
+		return
 	}
 
-	token, err := authentication.GenerateAdminToken(admin.Username)
+	tokens, err := authentication.StartSession(c, models.RoleAdmin, dbAdmin.Username, dbAdmin.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": token})
+	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": tokens.AccessToken, "refresh_token": tokens.RefreshToken, "expires_in": tokens.ExpiresIn})
 }
 
 func AdminLogout(c *gin.Context) {
+	if err := endCurrentSession(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
 }
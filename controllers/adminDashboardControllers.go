@@ -3,6 +3,7 @@ package controllers
 import (
 	"doc-connect/configuration"
 	"doc-connect/models"
+	"doc-connect/money"
 	"net/http"
 	"time"
 
@@ -21,7 +22,7 @@ func GetBookingStatusCounts(c *gin.Context) {
 
 	// Query the database to count the number of confirmed bookings
 	var confirmedBookings int64
-	confirmedResults := configuration.DB.Model(&models.Appointment{}).Where("booking_status = ?", "confirmed").Count(&confirmedBookings)
+	confirmedResults := configuration.DB.Model(&models.Appointment{}).Where("booking_status = ?", models.BookingConfirmed).Count(&confirmedBookings)
 	if confirmedResults.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch confirmed bookings"})
 		return
@@ -29,7 +30,7 @@ func GetBookingStatusCounts(c *gin.Context) {
 
 	// Query the database to count the number of completed bookings
 	var completedBookings int64
-	completedResult := configuration.DB.Model(&models.Appointment{}).Where("booking_status = ?", "completed").Count(&completedBookings)
+	completedResult := configuration.DB.Model(&models.Appointment{}).Where("booking_status = ?", models.BookingCompleted).Count(&completedBookings)
 	if completedResult.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch completed bookings"})
 		return
@@ -37,7 +38,7 @@ func GetBookingStatusCounts(c *gin.Context) {
 
 	// Query the database to count the number of cancelled bookings
 	var cancelledBookings int64
-	cancelledResult := configuration.DB.Model(&models.Appointment{}).Where("booking_status = ?", "cancelled").Count(&cancelledBookings)
+	cancelledResult := configuration.DB.Model(&models.Appointment{}).Where("booking_status = ?", models.BookingCancelled).Count(&cancelledBookings)
 	if cancelledResult.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch cancelled bookings"})
 		return
@@ -58,16 +59,17 @@ func GetBookingStatusCounts(c *gin.Context) {
 func GetDoctorWiseBookings(c *gin.Context) {
 	// Defined a struct to store doctor-wise data
 	var doctorData []struct {
-		DoctorID     int     `json:"doctor_id"`
-		BookingCount int     `json:"booking_count"`
-		TotalRevenue float64 `json:"total_revenue"`
+		DoctorID     int          `json:"doctor_id"`
+		BookingCount int          `json:"booking_count"`
+		TotalRevenue money.Amount `json:"total_revenue"`
+		Currency     string       `json:"currency"`
 	}
 
 	// Query the database to get doctor-wise data
 	result := configuration.DB.Table("appointments").
-		Select("appointments.doctor_id, COUNT(*) as booking_count, SUM(invoices.total_amount) as total_revenue").
+		Select("appointments.doctor_id, COUNT(*) as booking_count, SUM(invoices.total_amount) as total_revenue, invoices.currency").
 		Joins("INNER JOIN invoices ON appointments.appointment_id = invoices.appointment_id").
-		Group("appointments.doctor_id").
+		Group("appointments.doctor_id, invoices.currency").
 		Scan(&doctorData)
 
 	if result.Error != nil {
@@ -87,17 +89,18 @@ func GetDoctorWiseBookings(c *gin.Context) {
 func GetDepartmentWiseBookings(c *gin.Context) {
 	// Defined a struct to store department-wise data
 	var departmentData []struct {
-		Specialization string  `json:"specialization"`
-		BookingCount   int     `json:"booking_count"`
-		TotalRevenue   float64 `json:"total_revenue"`
+		Specialization string       `json:"specialization"`
+		BookingCount   int          `json:"booking_count"`
+		TotalRevenue   money.Amount `json:"total_revenue"`
+		Currency       string       `json:"currency"`
 	}
 
 	// Query the database to get doctor-wise data
 	result := configuration.DB.Table("appointments").
-		Select("doctors.specialization as specialization, COUNT(*) as booking_count, SUM(invoices.total_amount) as total_revenue").
+		Select("doctors.specialization as specialization, COUNT(*) as booking_count, SUM(invoices.total_amount) as total_revenue, invoices.currency").
 		Joins("JOIN doctors ON appointments.doctor_id = doctors.doctor_id").
 		Joins("JOIN invoices ON appointments.appointment_id = invoices.appointment_id").
-		Group("doctors.specialization").
+		Group("doctors.specialization, invoices.currency").
 		Scan(&departmentData)
 
 	if result.Error != nil {
@@ -115,10 +118,11 @@ func GetDepartmentWiseBookings(c *gin.Context) {
 
 // Defined a struct to store Revenue
 type Revenue struct {
-	Day   *float64 `json:"day"`
-	Week  *float64 `json:"week"`
-	Month *float64 `json:"month"`
-	Year  *float64 `json:"year"`
+	Day      *money.Amount `json:"day"`
+	Week     *money.Amount `json:"week"`
+	Month    *money.Amount `json:"month"`
+	Year     *money.Amount `json:"year"`
+	Currency string        `json:"currency"`
 }
 
 // Func to get total revenue
@@ -142,10 +146,10 @@ func GetTotalRevenue(c *gin.Context) {
 	endofYear := startofYear.AddDate(1, 0, 0).Add(-time.Second)
 
 	// Query the database to get the total revenue for different timeframes
-	var revenue Revenue
+	revenue := Revenue{Currency: money.INR}
 	result := configuration.DB.Model(&models.Invoice{}).
 		Select("SUM(total_amount) as total_revenue").
-		Where("payment_status = ?", "Paid").
+		Where("payment_status = ? AND currency = ?", models.InvoicePaid, money.INR).
 		Where("updated_at BETWEEN ? AND ?", startofDay, endofDay).
 		Scan(&revenue.Day)
 
@@ -157,7 +161,7 @@ func GetTotalRevenue(c *gin.Context) {
 	// Fetching revenue for the week
 	result = configuration.DB.Model(&models.Invoice{}).
 		Select("SUM(total_amount) as total_revenue").
-		Where("payment_status = ?", "Paid").
+		Where("payment_status = ? AND currency = ?", models.InvoicePaid, money.INR).
 		Where("updated_at BETWEEN ? AND ?", startofWeek, endofWeek).
 		Scan(&revenue.Week)
 
@@ -169,7 +173,7 @@ func GetTotalRevenue(c *gin.Context) {
 	// Fetching revenue for the month
 	result = configuration.DB.Model(&models.Invoice{}).
 		Select("SUM(total_amount) as total_revenue").
-		Where("payment_status = ?", "Paid").
+		Where("payment_status = ? AND currency = ?", models.InvoicePaid, money.INR).
 		Where("updated_at BETWEEN ? AND ?", startofMonth, endofMonth).
 		Scan(&revenue.Month)
 
@@ -181,7 +185,7 @@ func GetTotalRevenue(c *gin.Context) {
 	// Fetching revenue for the year
 	result = configuration.DB.Model(&models.Invoice{}).
 		Select("SUM(total_amount) as total_revenue").
-		Where("payment_status = ?", "Paid").
+		Where("payment_status = ? AND currency = ?", models.InvoicePaid, money.INR).
 		Where("updated_at BETWEEN ? AND ?", startofYear, endofYear).
 		Scan(&revenue.Year)
 
@@ -200,7 +204,8 @@ func GetTotalRevenue(c *gin.Context) {
 
 // Defined a struct to store Revenue for the specified date range
 type SpecificRevenue struct {
-	Revenue *float64 `json:"revenue"`
+	Revenue  *money.Amount `json:"revenue"`
+	Currency string        `json:"currency"`
 }
 
 func GetSpecificRevenue(c *gin.Context) {
@@ -233,10 +238,10 @@ func GetSpecificRevenue(c *gin.Context) {
 	}
 
 	// Query the database to get the total revenue for the specified date range
-	var specificRevenue SpecificRevenue
+	specificRevenue := SpecificRevenue{Currency: money.INR}
 	result := configuration.DB.Model(&models.Invoice{}).
 		Select("SUM(total_amount) as total_revenue").
-		Where("payment_status = ?", "Paid").
+		Where("payment_status = ? AND currency = ?", models.InvoicePaid, money.INR).
 		Where("updated_at BETWEEN ? AND ?", startDate, endDate).
 		Scan(&specificRevenue.Revenue)
 
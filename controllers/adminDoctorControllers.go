@@ -8,7 +8,6 @@ import (
 	"log"
 	"net/http"
 	"net/smtp"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -117,11 +116,15 @@ func SendEmailToDoctor(doctor models.Doctor) error {
 	body := fmt.Sprintf("Hello %s,\n\nYour details have been successfully updated.\n\nUpdated details:\nName: %s\nSpecialization: %s\nEmail: %s\nPhone: %s\nLicense Number: %s\nVerified: %s\nApproved: %s\n",
 		doctor.Name, doctor.Name, doctor.Specialization, doctor.Email, doctor.Phone, doctor.LicenseNumber, doctor.Verified, doctor.Approved)
 
+	if !configuration.Settings.Features.EmailNotifications {
+		return nil
+	}
+
 	// Set up SMTP authentication information
-	SMTPemail := os.Getenv("Email")
-	SMTPpass := os.Getenv("Password")
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
+	SMTPemail := configuration.Settings.SMTP.Username
+	SMTPpass := configuration.Settings.SMTP.Password
+	smtpHost := configuration.Settings.SMTP.Host
+	smtpPort := configuration.Settings.SMTP.Port
 
 	// Authenticate with SMTP server
 	auth := smtp.PlainAuth("", SMTPemail, SMTPpass, smtpHost)
@@ -144,7 +147,7 @@ func SendEmailToDoctor(doctor models.Doctor) error {
 	msg.WriteString(body)
 
 	// Send email using SMTP server
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, SMTPemail, []string{doctor.Email}, []byte(msg.String()))
+	err := smtp.SendMail(fmt.Sprintf("%s:%d", smtpHost, smtpPort), auth, SMTPemail, []string{doctor.Email}, []byte(msg.String()))
 	if err != nil {
 		log.Println("Error sending email:", err)
 		return err
@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"doc-connect/access"
+	"doc-connect/authentication"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// passwordTokenTTL is how long an invite or password reset link can be used
+const passwordTokenTTL = 72 * time.Hour
+
+// errLastSuperAdmin is returned when a change would leave no active super admin
+var errLastSuperAdmin = errors.New("there must be at least one active super admin")
+
+// InviteAdmin creates an admin account with a role and emails the invited admin a link to set
+// their password with
+func InviteAdmin(c *gin.Context) {
+	var inviteRequest struct {
+		Username string `json:"username" binding:"required"`
+		Email    string `json:"email" binding:"required,email"`
+		Role     string `json:"role" binding:"required"`
+	}
+	if err := c.BindJSON(&inviteRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !access.IsAdminRole(inviteRequest.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be super_admin, finance, verifier or support"})
+		return
+	}
+
+	admin := models.Admin{
+		Username: inviteRequest.Username,
+		Email:    inviteRequest.Email,
+		Role:     inviteRequest.Role,
+		Status:   models.AdminInvited,
+	}
+	token, err := newPasswordToken(&admin.PasswordTokenHash, &admin.PasswordTokenExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	if err := configuration.DB.Create(&admin).Error; errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create admin"})
+		return
+	}
+
+	sendPasswordLink(admin.Username, admin.Email, "/admin/set/password", token, "You have been invited as "+admin.Role+" admin")
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Admin invited, the invite link was emailed to " + admin.Email,
+		"data":    admin,
+	})
+}
+
+// ViewAdmins lists the admin accounts
+func ViewAdmins(c *gin.Context) {
+	var admins []models.Admin
+	if err := configuration.DB.Order("admin_id").Find(&admins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admins"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Admins fetched successfully",
+		"data":    admins,
+	})
+}
+
+// UpdateAdminRole assigns another role to an admin
+func UpdateAdminRole(c *gin.Context) {
+	var roleRequest struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.BindJSON(&roleRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !access.IsAdminRole(roleRequest.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be super_admin, finance, verifier or support"})
+		return
+	}
+
+	admin, ok := updateAdmin(c, func(tx *gorm.DB, admin *models.Admin) error {
+		admin.Role = roleRequest.Role
+		return tx.Model(admin).Update("role", admin.Role).Error
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Admin role updated successfully",
+		"data":    admin,
+	})
+}
+
+// DisableAdmin blocks an admin account and signs it out everywhere
+func DisableAdmin(c *gin.Context) {
+	admin, ok := updateAdmin(c, func(tx *gorm.DB, admin *models.Admin) error {
+		admin.Status = models.AdminDisabled
+		return tx.Model(admin).Update("status", admin.Status).Error
+	})
+	if !ok {
+		return
+	}
+	if err := authentication.RevokeAllSessions(models.RoleAdmin, admin.Username); err != nil {
+		log.Println("Failed to revoke sessions of disabled admin:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Admin disabled successfully",
+		"data":    admin,
+	})
+}
+
+// EnableAdmin unblocks a disabled admin account. Admins that never set a password stay invited.
+func EnableAdmin(c *gin.Context) {
+	admin, ok := updateAdmin(c, func(tx *gorm.DB, admin *models.Admin) error {
+		if admin.Status != models.AdminDisabled {
+			return nil
+		}
+		admin.Status = models.AdminActive
+		if admin.Password == "" {
+			admin.Status = models.AdminInvited
+		}
+		return tx.Model(admin).Update("status", admin.Status).Error
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Admin enabled successfully",
+		"data":    admin,
+	})
+}
+
+// ResetAdminPassword emails an admin a link to set a new password with. The current password
+// keeps working until the new one is set.
+func ResetAdminPassword(c *gin.Context) {
+	var token string
+	admin, ok := updateAdmin(c, func(tx *gorm.DB, admin *models.Admin) error {
+		var err error
+		if token, err = newPasswordToken(&admin.PasswordTokenHash, &admin.PasswordTokenExpiresAt); err != nil {
+			return err
+		}
+		return tx.Model(admin).Updates(map[string]interface{}{
+			"password_token_hash":       admin.PasswordTokenHash,
+			"password_token_expires_at": admin.PasswordTokenExpiresAt,
+		}).Error
+	})
+	if !ok {
+		return
+	}
+
+	sendPasswordLink(admin.Username, admin.Email, "/admin/set/password", token, "A password reset was requested for your admin account")
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Password reset link was emailed to " + admin.Email,
+	})
+}
+
+// SetAdminPassword sets the password of an admin with the token of an invite or reset link.
+// An invited admin becomes active, and every session of the admin is signed out.
+func SetAdminPassword(c *gin.Context) {
+	var passwordRequest struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+	if err := c.BindJSON(&passwordRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var admin models.Admin
+	if err := configuration.DB.Where("password_token_hash = ? AND password_token_expires_at > ?", authentication.HashToken(passwordRequest.Token), time.Now()).
+		First(&admin).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if admin.Status == models.AdminDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin account is disabled"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordRequest.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// The token can be used once
+	result := configuration.DB.Model(&models.Admin{}).Where("admin_id = ? AND password_token_hash = ?", admin.AdminID, admin.PasswordTokenHash).
+		Updates(map[string]interface{}{
+			"password":                  string(hashedPassword),
+			"status":                    models.AdminActive,
+			"password_token_hash":       "",
+			"password_token_expires_at": nil,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if err := authentication.RevokeAllSessions(models.RoleAdmin, admin.Username); err != nil {
+		log.Println("Failed to revoke sessions after password change:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Password set successfully, please log in",
+	})
+}
+
+// updateAdmin changes the admin of the id parameter, responding with an error if it fails. An
+// admin can't change their own account this way, and the last active super admin can't be
+// demoted or disabled.
+func updateAdmin(c *gin.Context, update func(tx *gorm.DB, admin *models.Admin) error) (models.Admin, bool) {
+	var admin models.Admin
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&admin, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if admin.Username == principal(c).Username {
+			return access.ErrForbidden
+		}
+		if err := update(tx, &admin); err != nil {
+			return err
+		}
+
+		var superAdmins int64
+		if err := tx.Model(&models.Admin{}).Where("role = ? AND status = ?", models.AdminRoleSuperAdmin, models.AdminActive).
+			Count(&superAdmins).Error; err != nil {
+			return err
+		}
+		if superAdmins == 0 {
+			return errLastSuperAdmin
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		return admin, true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+	case errors.Is(err, access.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't change your own admin account"})
+	case errors.Is(err, errLastSuperAdmin):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update admin"})
+	}
+	return admin, false
+}
+
+// newPasswordToken makes a new token to set a password with, replacing any earlier one
+func newPasswordToken(tokenHash *string, expiresAt **time.Time) (string, error) {
+	token, err := authentication.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(passwordTokenTTL)
+	*tokenHash = authentication.HashToken(token)
+	*expiresAt = &expires
+	return token, nil
+}
+
+// sendPasswordLink emails the token to set a password with at path
+func sendPasswordLink(name, email, path, token, reason string) {
+	msg := fmt.Sprintf("Hello %s,\n\n%s on %s.\n\nSet your password by sending this token with your new password to %s%s:\n\n%s\n\nThe token expires in %s.",
+		name, reason, configuration.AppBaseURL(), configuration.AppBaseURL(), path, token, passwordTokenTTL)
+	if err := SendNotificationEmail("Set your password", msg, email); err != nil {
+		log.Println("Failed to send password email:", err)
+	}
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/lifecycle"
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errInvoiceNotPayable is returned when an invoice is no longer waiting for payment
+var errInvoiceNotPayable = errors.New("invoice is not pending payment")
+
+// actorFromContext describes the authenticated caller for the transition history
+func actorFromContext(c *gin.Context) string {
+	// Staff acting for a doctor also have the doctor id set
+	if staffID, ok := c.Get("staff_id"); ok {
+		return fmt.Sprintf("staff:%v", staffID)
+	}
+	if doctorID, ok := c.Get("doctor_id"); ok {
+		return fmt.Sprintf("doctor:%v", doctorID)
+	}
+	if patientID, ok := c.Get("patientID"); ok {
+		return fmt.Sprintf("patient:%v", patientID)
+	}
+	if username, ok := c.Get("username"); ok {
+		return fmt.Sprintf("admin:%v", username)
+	}
+	return "system"
+}
+
+// markInvoicePaid pays the outstanding amount of a pending or partially paid invoice with the
+// given method and confirms its booking. An invoice whose total or paid amount changed since it
+// was read is not marked as paid.
+func markInvoicePaid(tx *gorm.DB, invoice *models.Invoice, paymentMethod, actor string) (models.Appointment, error) {
+	var appointment models.Appointment
+
+	// An invoice paid with more than one method is split
+	invoiceMethod := paymentMethod
+	if invoice.AmountPaid > 0 && invoice.PaymentMethod != paymentMethod {
+		invoiceMethod = models.PaymentMethodSplit
+	}
+	payment := models.InvoicePayment{
+		InvoiceID: invoice.InvoiceID,
+		Method:    paymentMethod,
+		Amount:    invoice.Outstanding().Amount,
+		Currency:  invoice.Currency,
+		Status:    models.InvoicePaymentApplied,
+	}
+
+	result := tx.Model(&models.Invoice{}).
+		Where("invoice_id = ? AND payment_status IN ? AND total_amount = ? AND amount_paid = ?",
+			invoice.InvoiceID, invoicePayableStatuses, invoice.TotalAmount, invoice.AmountPaid).
+		Updates(map[string]interface{}{"payment_status": models.InvoicePaid, "payment_method": invoiceMethod, "amount_paid": invoice.TotalAmount})
+	if result.Error != nil {
+		return appointment, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return appointment, errInvoiceNotPayable
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return appointment, err
+	}
+	invoice.PaymentStatus = models.InvoicePaid
+	invoice.PaymentMethod = invoiceMethod
+	invoice.AmountPaid = invoice.TotalAmount
+	invoice.Payments = append(invoice.Payments, payment)
+	invoice.UpdatedAt = time.Now()
+
+	if err := tx.Where("appointment_id = ?", invoice.AppointmentID).First(&appointment).Error; err != nil {
+		return appointment, err
+	}
+
+	err := lifecycle.Transition(tx, &appointment, lifecycle.Change{
+		To:            models.BookingConfirmed,
+		PaymentStatus: models.AppointmentPaymentPaid,
+		Actor:         actor,
+		Reason:        "invoice paid " + paymentMethod,
+	})
+	return appointment, err
+}
+
+// transitionError responds with the error of a failed status transition
+func transitionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, lifecycle.ErrIllegalTransition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrStaleAppointment):
+		c.JSON(http.StatusConflict, gin.H{"error": "Appointment was changed meanwhile, please retry"})
+	case errors.Is(err, errInvoiceNotPayable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invoice is not pending payment"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment status"})
+	}
+}
+
+// StartConsultation moves a confirmed appointment of the doctor into consultation
+func StartConsultation(c *gin.Context) {
+	appointment, _, ok := appointmentForCaller(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := lifecycle.Transition(configuration.DB, &appointment, lifecycle.Change{
+		To:     models.BookingInConsultation,
+		Actor:  actorFromContext(c),
+		Reason: "consultation started",
+	}); err != nil {
+		transitionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Consultation started",
+		"data":    appointment,
+	})
+}
+
+// GetAppointmentTransitions lists the status history of an appointment
+func GetAppointmentTransitions(c *gin.Context) {
+	var transitions []models.AppointmentTransition
+	if err := configuration.DB.Where("appointment_id = ?", c.Param("id")).Order("created_at, id").Find(&transitions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointment transitions"})
+		return
+	}
+	if len(transitions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No history found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Appointment transitions fetched successfully",
+		"data":    transitions,
+	})
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"doc-connect/access"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principal is the authenticated user of the request
+func principal(c *gin.Context) access.Principal {
+	p, _ := access.FromContext(c)
+	return p
+}
+
+// authorized responds to a request the access policies refused and reports whether it may go on
+func authorized(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, access.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this resource"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+	}
+	return false
+}
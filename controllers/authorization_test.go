@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"doc-connect/access"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveAs sends a request to a handler mounted on route, authenticated as p
+func serveAs(p access.Principal, method, route string, handler gin.HandlerFunc, path string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, route, withPrincipal(p), handler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+// createDoctor stores a doctor working for a hospital
+func createDoctor(t *testing.T, hospitalID uint) models.Doctor {
+	t.Helper()
+	doctor := models.Doctor{
+		Name:           "Doctor",
+		Gender:         "female",
+		Specialization: "General",
+		Email:          fmt.Sprintf("doctor%d@example.com", hospitalID),
+		Password:       "secret",
+		Phone:          "9999999999",
+		LicenseNumber:  "LIC",
+		HospitalID:     hospitalID,
+	}
+	if err := configuration.DB.Create(&doctor).Error; err != nil {
+		t.Fatalf("Failed to create doctor: %v", err)
+	}
+	return doctor
+}
+
+func TestWalletOfAnotherPatient(t *testing.T) {
+	patient := access.Principal{Role: models.RolePatient, PatientID: 1}
+	for _, path := range []string{"/user/wallet/2", "/user/wallet/1abc"} {
+		w := serveAs(patient, http.MethodGet, "/user/wallet/:userid", Wallet, path)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET %s answered %d, want %d: %s", path, w.Code, http.StatusForbidden, w.Body)
+		}
+	}
+}
+
+func TestDoctorAppointmentsByDateOfAnotherDoctor(t *testing.T) {
+	doctor := access.Principal{Role: models.RoleDoctor, DoctorID: 1}
+	for _, path := range []string{"/doctor/appointment/2/date?date=2026-01-05", "/doctor/appointment/abc/date?date=2026-01-05"} {
+		w := serveAs(doctor, http.MethodGet, "/doctor/appointment/:doctor_id/date", GetDoctorAppointmentsByDate, path)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET %s answered %d, want %d: %s", path, w.Code, http.StatusForbidden, w.Body)
+		}
+	}
+}
+
+func TestDoctorAppointmentsByDateOfAnotherHospital(t *testing.T) {
+	useTestDB(t)
+	doctor := createDoctor(t, 1)
+
+	staff := access.Principal{Role: models.RoleHospitalStaff, HospitalID: 2}
+	path := fmt.Sprintf("/doctor/appointment/%d/date?date=2026-01-05", doctor.DoctorID)
+	w := serveAs(staff, http.MethodGet, "/doctor/appointment/:doctor_id/date", GetDoctorAppointmentsByDate, path)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("GET %s answered %d, want %d: %s", path, w.Code, http.StatusForbidden, w.Body)
+	}
+}
+
+// Appointments of another patient, doctor or hospital are answered as missing
+func TestAppointmentRoutesOfAnotherTenant(t *testing.T) {
+	useTestDB(t)
+	doctor := createDoctor(t, 1)
+	appointment, _ := createPendingBooking(t, 1, doctor.DoctorID, 50000)
+
+	routes := []struct {
+		method  string
+		route   string
+		path    string
+		handler gin.HandlerFunc
+	}{
+		{http.MethodPost, "/user/cancel/appointment/:id", "/user/cancel/appointment/%d", CancelAppointment},
+		{http.MethodGet, "/user/reschedule/history/:id", "/user/reschedule/history/%d", GetRescheduleHistory},
+	}
+	callers := []struct {
+		name      string
+		principal access.Principal
+	}{
+		{"another patient", access.Principal{Role: models.RolePatient, PatientID: 2}},
+		{"another doctor", access.Principal{Role: models.RoleDoctor, DoctorID: doctor.DoctorID + 1}},
+		{"staff of another hospital", access.Principal{Role: models.RoleHospitalStaff, HospitalID: 2}},
+	}
+	for _, route := range routes {
+		path := fmt.Sprintf(route.path, appointment.AppointmentID)
+		for _, caller := range callers {
+			t.Run(caller.name+" "+route.method+" "+route.route, func(t *testing.T) {
+				w := serveAs(caller.principal, route.method, route.route, route.handler, path)
+				if w.Code != http.StatusNotFound {
+					t.Errorf("%s %s answered %d, want %d: %s", route.method, path, w.Code, http.StatusNotFound, w.Body)
+				}
+			})
+		}
+	}
+
+	if err := configuration.DB.First(&appointment, appointment.AppointmentID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if appointment.BookingStatus != models.BookingPending {
+		t.Errorf("booking is %s after the refused requests, want it still %s", appointment.BookingStatus, models.BookingPending)
+	}
+
+	// Its own patient still sees the history
+	path := fmt.Sprintf("/user/reschedule/history/%d", appointment.AppointmentID)
+	w := serveAs(access.Principal{Role: models.RolePatient, PatientID: 1}, http.MethodGet, "/user/reschedule/history/:id", GetRescheduleHistory, path)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET %s by its patient answered %d, want %d: %s", path, w.Code, http.StatusOK, w.Body)
+	}
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Slot length used when a window doesn't specify one and for legacy "HH:MM-HH:MM" availabilities
+const defaultSlotMinutes = 30
+
+// availabilityWindows returns the windows of an availability, converting the legacy
+// single "HH:MM-HH:MM" string into one window of default slot length
+func availabilityWindows(availability *models.DoctorAvailability) []models.AvailabilityWindow {
+	if len(availability.Windows) > 0 {
+		return availability.Windows
+	}
+	startTime, endTime := splitAvailabilityTime(availability.AvilableTime)
+	if startTime == "" || endTime == "" {
+		return nil
+	}
+	return []models.AvailabilityWindow{{
+		StartTime:   startTime,
+		EndTime:     endTime,
+		SlotMinutes: defaultSlotMinutes,
+	}}
+}
+
+// normalizeWindows validates windows sent by a doctor, applies the default slot length
+// and returns them sorted by start time
+func normalizeWindows(windows []models.AvailabilityWindow) ([]models.AvailabilityWindow, error) {
+	normalized := make([]models.AvailabilityWindow, 0, len(windows))
+	for _, window := range windows {
+		start, err := time.Parse("15:04", window.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start time %q, use HH:MM", window.StartTime)
+		}
+		end, err := time.Parse("15:04", window.EndTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end time %q, use HH:MM", window.EndTime)
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("window %s-%s ends before it starts", window.StartTime, window.EndTime)
+		}
+		if window.SlotMinutes == 0 {
+			window.SlotMinutes = defaultSlotMinutes
+		}
+		if window.SlotMinutes < 0 || window.BufferMinutes < 0 {
+			return nil, errors.New("slot and buffer minutes cannot be negative")
+		}
+		if start.Add(time.Duration(window.SlotMinutes) * time.Minute).After(end) {
+			return nil, fmt.Errorf("window %s-%s is shorter than one %d minute slot", window.StartTime, window.EndTime, window.SlotMinutes)
+		}
+		normalized = append(normalized, models.AvailabilityWindow{
+			StartTime:     start.Format("15:04"),
+			EndTime:       end.Format("15:04"),
+			SlotMinutes:   window.SlotMinutes,
+			BufferMinutes: window.BufferMinutes,
+		})
+	}
+
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].StartTime < normalized[j].StartTime })
+
+	// Windows of the same day must not overlap
+	for i := 1; i < len(normalized); i++ {
+		if normalized[i].StartTime < normalized[i-1].EndTime {
+			return nil, fmt.Errorf("window %s-%s overlaps with %s-%s", normalized[i].StartTime, normalized[i].EndTime, normalized[i-1].StartTime, normalized[i-1].EndTime)
+		}
+	}
+	return normalized, nil
+}
+
+// windowsFromRequest builds the windows of an availability from either the structured
+// windows or the legacy "HH:MM-HH:MM" string of a request
+func windowsFromRequest(availableTime string, windows []models.AvailabilityWindow) ([]models.AvailabilityWindow, error) {
+	if len(windows) == 0 {
+		startTime, endTime := splitAvailabilityTime(availableTime)
+		if startTime == "" || endTime == "" {
+			return nil, errors.New("either windows or available_time in HH:MM-HH:MM format is required")
+		}
+		windows = []models.AvailabilityWindow{{StartTime: startTime, EndTime: endTime}}
+	}
+	return normalizeWindows(windows)
+}
+
+// copyWindows returns unsaved copies of windows so they can be attached to another availability
+func copyWindows(windows []models.AvailabilityWindow) []models.AvailabilityWindow {
+	copied := make([]models.AvailabilityWindow, 0, len(windows))
+	for _, window := range windows {
+		copied = append(copied, models.AvailabilityWindow{
+			StartTime:     window.StartTime,
+			EndTime:       window.EndTime,
+			SlotMinutes:   window.SlotMinutes,
+			BufferMinutes: window.BufferMinutes,
+		})
+	}
+	return copied
+}
+
+// generateTimeSlots divides every window into "HH:MM-HH:MM" slots of the window's
+// slot length, leaving the window's buffer between consecutive slots
+func generateTimeSlots(windows []models.AvailabilityWindow) []string {
+	var slots []string
+	for _, window := range windows {
+		start, err := time.Parse("15:04", window.StartTime)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse("15:04", window.EndTime)
+		if err != nil {
+			continue
+		}
+		slotMinutes := window.SlotMinutes
+		if slotMinutes <= 0 {
+			slotMinutes = defaultSlotMinutes
+		}
+		slotLength := time.Duration(slotMinutes) * time.Minute
+		step := slotLength + time.Duration(window.BufferMinutes)*time.Minute
+
+		for t := start; !t.Add(slotLength).After(end); t = t.Add(step) {
+			slots = append(slots, fmt.Sprintf("%s-%s", t.Format("15:04"), t.Add(slotLength).Format("15:04")))
+		}
+	}
+	return slots
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AddCommission sets the commission of a doctor or of the doctors of a hospital
+func AddCommission(c *gin.Context) {
+	var commission models.Commission
+	if err := c.BindJSON(&commission); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	commission.ID = 0
+
+	if err := validateCommission(commission); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := configuration.DB.Create(&commission).Error; errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A commission is already set for this doctor or hospital"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add commission"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Commission added successfully",
+		"data":    commission,
+	})
+}
+
+// ViewCommissions lists the commissions set for doctors and hospitals, and the default
+// commission of everyone else
+func ViewCommissions(c *gin.Context) {
+	var commissions []models.Commission
+	if err := configuration.DB.Order("id").Find(&commissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":          "Success",
+		"Message":         "Commissions fetched successfully",
+		"data":            commissions,
+		"default_percent": configuration.PlatformCommission(),
+	})
+}
+
+// UpdateCommission changes the percent of a commission. Payouts already generated keep the
+// commission they were generated with.
+func UpdateCommission(c *gin.Context) {
+	var commission models.Commission
+	if err := configuration.DB.First(&commission, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commission not found"})
+		return
+	}
+
+	var commissionRequest struct {
+		Percent float64 `json:"percent"`
+	}
+	if err := c.BindJSON(&commissionRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	commission.Percent = commissionRequest.Percent
+
+	if err := validateCommission(commission); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := configuration.DB.Save(&commission).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update commission"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Commission updated successfully",
+		"data":    commission,
+	})
+}
+
+// RemoveCommission deletes a commission, its doctors fall back to the hospital or default commission
+func RemoveCommission(c *gin.Context) {
+	result := configuration.DB.Delete(&models.Commission{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove commission"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commission not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Commission removed successfully",
+	})
+}
+
+// validateCommission checks the values of a commission sent by an admin
+func validateCommission(commission models.Commission) error {
+	if (commission.DoctorID == 0) == (commission.HospitalID == 0) {
+		return errors.New("either doctor_id or hospital_id is required")
+	}
+	if commission.Percent < 0 || commission.Percent > 100 {
+		return errors.New("percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// commissionPercent is the commission kept from a doctor: the doctor's own, else the
+// hospital's, else the default
+func commissionPercent(tx *gorm.DB, doctor models.Doctor) (float64, error) {
+	var commissions []models.Commission
+	if err := tx.Where("doctor_id = ? OR (doctor_id = 0 AND hospital_id = ?)", doctor.DoctorID, doctor.HospitalID).
+		Order("doctor_id DESC").Find(&commissions).Error; err != nil {
+		return 0, err
+	}
+	if len(commissions) > 0 {
+		return commissions[0].Percent, nil
+	}
+	return configuration.PlatformCommission(), nil
+}
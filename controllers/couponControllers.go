@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors of applying a coupon to an invoice
+var (
+	errCouponNotFound      = errors.New("coupon not found")
+	errCouponNotApplicable = errors.New("coupon cannot be applied")
+)
+
+// AddCoupon adds a promo code patients can apply to their invoices
+func AddCoupon(c *gin.Context) {
+	coupon := models.Coupon{Active: true}
+	if err := c.BindJSON(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	coupon.ID = 0
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+
+	if err := validateCoupon(coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := configuration.DB.Create(&coupon).Error; errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A coupon with this code already exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Coupon added successfully",
+		"data":    coupon,
+	})
+}
+
+// ViewCoupons lists the coupons with the number of times each was redeemed
+func ViewCoupons(c *gin.Context) {
+	var coupons []models.Coupon
+	if err := configuration.DB.Order("id DESC").Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+		return
+	}
+
+	var counts []struct {
+		CouponID    uint
+		Redemptions int64
+	}
+	if err := configuration.DB.Model(&models.CouponRedemption{}).
+		Select("coupon_id, COUNT(*) AS redemptions").
+		Group("coupon_id").
+		Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupon redemptions"})
+		return
+	}
+	redemptions := map[uint]int64{}
+	for _, count := range counts {
+		redemptions[count.CouponID] = count.Redemptions
+	}
+
+	type couponUsage struct {
+		models.Coupon
+		Redemptions int64 `json:"redemptions"`
+	}
+	data := make([]couponUsage, 0, len(coupons))
+	for _, coupon := range coupons {
+		data = append(data, couponUsage{Coupon: coupon, Redemptions: redemptions[coupon.ID]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Coupons fetched successfully",
+		"data":    data,
+	})
+}
+
+// UpdateCoupon updates a coupon, e.g. to extend its validity or deactivate it
+func UpdateCoupon(c *gin.Context) {
+	var coupon models.Coupon
+	if err := configuration.DB.First(&coupon, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	// The code identifies the coupon on redeemed invoices
+	id, code := coupon.ID, coupon.Code
+	if err := c.BindJSON(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	coupon.ID, coupon.Code = id, code
+
+	if err := validateCoupon(coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := configuration.DB.Save(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Coupon updated successfully",
+		"data":    coupon,
+	})
+}
+
+// ViewCouponRedemptions lists the redemptions of a coupon
+func ViewCouponRedemptions(c *gin.Context) {
+	var redemptions []models.CouponRedemption
+	if err := configuration.DB.Where("coupon_id = ?", c.Param("id")).Order("created_at DESC").Find(&redemptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupon redemptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Coupon redemptions fetched successfully",
+		"data":    redemptions,
+	})
+}
+
+// ApplyCoupon applies a coupon to a pending invoice of the patient
+func ApplyCoupon(c *gin.Context) {
+	var couponRequest struct {
+		InvoiceID  uint   `json:"invoice_id" binding:"required"`
+		CouponCode string `json:"coupon_code" binding:"required"`
+	}
+
+	if err := c.BindJSON(&couponRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patientID, _ := c.Get("patientID")
+	var invoice models.Invoice
+	if err := configuration.DB.Where("invoice_id = ? AND patient_id = ?", couponRequest.InvoiceID, patientID).First(&invoice).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+	if invoice.PaymentStatus != models.InvoicePending || paymentWindowExpired(invoice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupons can only be applied to pending invoices"})
+		return
+	}
+
+	var redemption models.CouponRedemption
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("invoice_id = ?", invoice.InvoiceID).Order("id").Find(&invoice.Items).Error; err != nil {
+			return err
+		}
+		var err error
+		redemption, err = applyCoupon(tx, &invoice, couponRequest.CouponCode)
+		return err
+	})
+	if couponFailed(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":     "Success",
+		"Message":    "Coupon applied successfully",
+		"data":       invoice,
+		"redemption": redemption,
+	})
+}
+
+// couponFailed responds with the error of applying a coupon, if any
+func couponFailed(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errCouponNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+	case errors.Is(err, errCouponNotApplicable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvoiceNotPayable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coupons can only be applied to pending invoices"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+	}
+	return true
+}
+
+// applyCoupon discounts the consultation fee of a pending invoice, whose items are loaded,
+// with a coupon and records the redemption. The coupon row is locked so usage caps hold
+// with concurrent redemptions.
+func applyCoupon(tx *gorm.DB, invoice *models.Invoice, code string) (models.CouponRedemption, error) {
+	var redemption models.CouponRedemption
+	if invoice.CouponCode != "" {
+		return redemption, fmt.Errorf("%w: coupon %s is already applied to the invoice", errCouponNotApplicable, invoice.CouponCode)
+	}
+
+	var coupon models.Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ? AND active = ?", strings.ToUpper(strings.TrimSpace(code)), true).First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return redemption, errCouponNotFound
+	}
+	if err != nil {
+		return redemption, err
+	}
+
+	if err := checkCouponApplies(tx, coupon, *invoice); err != nil {
+		return redemption, err
+	}
+
+	// Only the consultation fee is discounted
+	var consultation *models.InvoiceItem
+	for i := range invoice.Items {
+		if invoice.Items[i].Kind == models.InvoiceItemConsultation {
+			consultation = &invoice.Items[i]
+			break
+		}
+	}
+	if consultation == nil {
+		return redemption, fmt.Errorf("%w: the invoice has no consultation fee", errCouponNotApplicable)
+	}
+
+	price := consultation.UnitPrice*money.Amount(consultation.Quantity) - consultation.Discount
+	discount := couponDiscount(coupon, price)
+	if discount <= 0 {
+		return redemption, fmt.Errorf("%w: the coupon gives no discount on this invoice", errCouponNotApplicable)
+	}
+
+	if err := tx.Model(consultation).Update("discount", consultation.Discount+discount).Error; err != nil {
+		return redemption, err
+	}
+	if err := retotalInvoice(tx, invoice); err != nil {
+		return redemption, err
+	}
+	if err := tx.Model(&models.Invoice{}).Where("invoice_id = ?", invoice.InvoiceID).Update("coupon_code", coupon.Code).Error; err != nil {
+		return redemption, err
+	}
+	invoice.CouponCode = coupon.Code
+
+	redemption = models.CouponRedemption{
+		CouponID:  coupon.ID,
+		PatientID: invoice.PatientID,
+		InvoiceID: invoice.InvoiceID,
+		Discount:  discount,
+	}
+	return redemption, tx.Create(&redemption).Error
+}
+
+// checkCouponApplies checks the validity, restrictions and usage caps of a coupon for an invoice
+func checkCouponApplies(tx *gorm.DB, coupon models.Coupon, invoice models.Invoice) error {
+	now := time.Now()
+	if coupon.ValidFrom != nil && now.Before(*coupon.ValidFrom) {
+		return fmt.Errorf("%w: the coupon is not valid yet", errCouponNotApplicable)
+	}
+	if coupon.ValidUntil != nil && now.After(*coupon.ValidUntil) {
+		return fmt.Errorf("%w: the coupon has expired", errCouponNotApplicable)
+	}
+
+	var doctor models.Doctor
+	if err := tx.First(&doctor, invoice.DoctorID).Error; err != nil {
+		return err
+	}
+	if coupon.DoctorID != 0 && coupon.DoctorID != doctor.DoctorID {
+		return fmt.Errorf("%w: the coupon is not valid for this doctor", errCouponNotApplicable)
+	}
+	if coupon.HospitalID != 0 && coupon.HospitalID != doctor.HospitalID {
+		return fmt.Errorf("%w: the coupon is not valid for this hospital", errCouponNotApplicable)
+	}
+	if coupon.Specialization != "" && !strings.EqualFold(coupon.Specialization, doctor.Specialization) {
+		return fmt.Errorf("%w: the coupon is only valid for %s", errCouponNotApplicable, coupon.Specialization)
+	}
+
+	if coupon.MaxRedemptions > 0 {
+		var redeemed int64
+		if err := tx.Model(&models.CouponRedemption{}).Where("coupon_id = ?", coupon.ID).Count(&redeemed).Error; err != nil {
+			return err
+		}
+		if redeemed >= int64(coupon.MaxRedemptions) {
+			return fmt.Errorf("%w: the coupon has been fully redeemed", errCouponNotApplicable)
+		}
+	}
+	if coupon.MaxPerPatient > 0 {
+		var redeemed int64
+		if err := tx.Model(&models.CouponRedemption{}).Where("coupon_id = ? AND patient_id = ?", coupon.ID, invoice.PatientID).Count(&redeemed).Error; err != nil {
+			return err
+		}
+		if redeemed >= int64(coupon.MaxPerPatient) {
+			return fmt.Errorf("%w: you have already used the coupon", errCouponNotApplicable)
+		}
+	}
+
+	if coupon.FirstConsultationOnly {
+		var previous int64
+		if err := tx.Model(&models.Appointment{}).
+			Where("patient_id = ? AND appointment_id <> ? AND booking_status IN ?", invoice.PatientID, invoice.AppointmentID,
+				[]string{models.BookingConfirmed, models.BookingInConsultation, models.BookingCompleted, models.BookingNoShow}).
+			Count(&previous).Error; err != nil {
+			return err
+		}
+		if previous > 0 {
+			return fmt.Errorf("%w: the coupon is only valid for a first consultation", errCouponNotApplicable)
+		}
+	}
+	return nil
+}
+
+// couponDiscount is the discount a coupon gives on a price, at most the price
+func couponDiscount(coupon models.Coupon, price money.Amount) money.Amount {
+	var discount money.Amount
+	switch coupon.DiscountType {
+	case models.CouponPercent:
+		discount = price.Percent(coupon.PercentOff)
+		if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
+			discount = coupon.MaxDiscount
+		}
+	case models.CouponFlat:
+		discount = coupon.AmountOff
+	}
+	if discount > price {
+		discount = price
+	}
+	return discount
+}
+
+// releaseCouponRedemptions frees the coupons redeemed on the unpaid invoice of an appointment,
+// so they count against no usage cap
+func releaseCouponRedemptions(tx *gorm.DB, appointmentID int) error {
+	return tx.Where("invoice_id IN (?)", tx.Model(&models.Invoice{}).Select("invoice_id").
+		Where("appointment_id = ? AND payment_status = ?", appointmentID, models.InvoicePending)).
+		Delete(&models.CouponRedemption{}).Error
+}
+
+// validateCoupon checks the values of a coupon sent by an admin
+func validateCoupon(coupon models.Coupon) error {
+	if coupon.Code == "" {
+		return errors.New("code is required")
+	}
+
+	switch coupon.DiscountType {
+	case models.CouponPercent:
+		if coupon.PercentOff <= 0 || coupon.PercentOff > 100 {
+			return errors.New("percent_off must be between 0 and 100")
+		}
+	case models.CouponFlat:
+		if coupon.AmountOff <= 0 {
+			return errors.New("amount_off must be positive")
+		}
+	default:
+		return errors.New("discount_type must be percent or flat")
+	}
+
+	if coupon.MaxDiscount < 0 {
+		return errors.New("max_discount cannot be negative")
+	}
+	if coupon.ValidFrom != nil && coupon.ValidUntil != nil && coupon.ValidUntil.Before(*coupon.ValidFrom) {
+		return errors.New("valid_until must be after valid_from")
+	}
+	if coupon.MaxRedemptions < 0 || coupon.MaxPerPatient < 0 {
+		return errors.New("usage caps cannot be negative")
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"doc-connect/models"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -258,13 +259,13 @@ func DoctorLogin(c *gin.Context) {
 		return
 	}
 
-	// Generating JWT token for authenticated doctor
-	token, err := authentication.GenerateDoctorToken(doctors.Email, existingDoctor.DoctorID)
+	// Starting a session for the authenticated doctor
+	tokens, err := authentication.StartSession(c, models.RoleDoctor, strconv.FormatUint(uint64(existingDoctor.DoctorID), 10), existingDoctor.Email)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": token})
+	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": tokens.AccessToken, "refresh_token": tokens.RefreshToken, "expires_in": tokens.ExpiresIn})
 
 }
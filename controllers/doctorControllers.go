@@ -2,7 +2,9 @@ package controllers
 
 import (
 	"bytes"
+	"doc-connect/access"
 	"doc-connect/configuration"
+	"doc-connect/lifecycle"
 	"doc-connect/models"
 	"errors"
 	"fmt"
@@ -32,10 +34,14 @@ func ViewHospital(c *gin.Context) {
 
 // DoctorLogout
 func DoctorLogout(c *gin.Context) {
+	if err := endCurrentSession(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "You are successfully logged out"})
 }
 
-// SaveAvailability saves the availability of a doctor
+// SaveAvailability saves the availability of a doctor for a specific date, overriding the weekly schedule
 func SaveAvailability(c *gin.Context) {
 	var availability models.DoctorAvailability
 
@@ -65,6 +71,13 @@ func SaveAvailability(c *gin.Context) {
 		return
 	}
 
+	windows, err := windowsFromRequest(availability.AvilableTime, availability.Windows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	availability.Windows = windows
+
 	// Check if availability for the given date already exists
 	var existingAvailability models.DoctorAvailability
 	if err := configuration.DB.Where("doctor_id = ? AND date = ?", availability.DoctorID, availability.Date).First(&existingAvailability).Error; err == nil {
@@ -122,26 +135,33 @@ func AddPrescription(c *gin.Context) {
 	}
 
 	switch appointment.BookingStatus {
-	case "pending":
+	case models.BookingPending:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointment is not confirmed"})
 		return
-	case "completed":
+	case models.BookingCompleted:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Prescription already added for this appointment"})
 		return
-	case "cancelled":
+	case models.BookingCancelled:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointment has been cancelled"})
 		return
-	}
-
-	// Create new prescription record in the database
-	if err := configuration.DB.Create(&prescription).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add prescription"})
+	case models.BookingNoShow:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Patient did not show up for this appointment"})
 		return
 	}
 
-	// Update appointment status to completed
-	if err := configuration.DB.Model(&appointment).Update("booking_status", "completed").Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment status"})
+	// Create the prescription and complete the appointment together
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&prescription).Error; err != nil {
+			return err
+		}
+		return lifecycle.Transition(tx, &appointment, lifecycle.Change{
+			To:     models.BookingCompleted,
+			Actor:  actorFromContext(c),
+			Reason: "prescription added",
+		})
+	})
+	if err != nil {
+		transitionError(c, err)
 		return
 	}
 
@@ -169,6 +189,9 @@ func AddPrescription(c *gin.Context) {
 func GetAppHistory(c *gin.Context) {
 	var appointment []models.Appointment
 	doctorID := c.Param("id")
+	if !authorized(c, access.DoctorParam(configuration.DB, principal(c), doctorID)) {
+		return
+	}
 
 	if err := configuration.DB.Where("doctor_id = ?", doctorID).Find(&appointment).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -194,6 +217,9 @@ func GetAppHistory(c *gin.Context) {
 
 func GetDoctorAppointmentsByDate(c *gin.Context) {
 	doctorID := c.Param("doctor_id")
+	if !authorized(c, access.DoctorParam(configuration.DB, principal(c), doctorID)) {
+		return
+	}
 	dateStr := c.Query("date")
 
 	// Parse the date string into time.Time format
@@ -205,7 +231,7 @@ func GetDoctorAppointmentsByDate(c *gin.Context) {
 
 	// Query appointments
 	var appointments []models.Appointment
-	if err := configuration.DB.Where("doctor_id = ? AND appointment_date = ? AND booking_status = ?", doctorID, date, "confirmed").Find(&appointments).Error; err != nil {
+	if err := configuration.DB.Where("doctor_id = ? AND appointment_date = ? AND booking_status = ?", doctorID, date, models.BookingConfirmed).Find(&appointments).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointments"})
 		return
 	}
@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// weekdays maps weekday names accepted in requests to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// SaveWeeklySchedule saves a recurring weekly availability template of a doctor
+func SaveWeeklySchedule(c *gin.Context) {
+	var scheduleRequest struct {
+		Weekdays       []string                    `json:"weekdays" binding:"required"`
+		AvailableTime  string                      `json:"available_time"`
+		Windows        []models.AvailabilityWindow `json:"windows"`
+		EffectiveFrom  string                      `json:"effective_from" binding:"required"`
+		EffectiveUntil string                      `json:"effective_until"`
+	}
+
+	if err := c.BindJSON(&scheduleRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	doctorID, ok := c.Get("doctor_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Doctor not authenticated"})
+		return
+	}
+
+	// Check if doctor is approved
+	var doctor models.Doctor
+	if err := configuration.DB.Where("doctor_id = ?", doctorID).First(&doctor).Error; err != nil || doctor.Approved != "true" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+		return
+	}
+
+	windows, err := windowsFromRequest(scheduleRequest.AvailableTime, scheduleRequest.Windows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	effectiveFrom, err := time.Parse("2006-01-02", scheduleRequest.EffectiveFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid effective from date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	var effectiveUntil *time.Time
+	if scheduleRequest.EffectiveUntil != "" {
+		until, err := time.Parse("2006-01-02", scheduleRequest.EffectiveUntil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid effective until date format. Use YYYY-MM-DD"})
+			return
+		}
+		if until.Before(effectiveFrom) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Effective until date cannot be before effective from date"})
+			return
+		}
+		effectiveUntil = &until
+	}
+
+	// Build one schedule row per weekday
+	var schedules []models.DoctorWeeklySchedule
+	for _, name := range scheduleRequest.Weekdays {
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid weekday: " + name})
+			return
+		}
+		schedules = append(schedules, models.DoctorWeeklySchedule{
+			DoctorID:       doctor.DoctorID,
+			Weekday:        int(weekday),
+			AvailableTime:  strings.TrimSpace(scheduleRequest.AvailableTime),
+			EffectiveFrom:  effectiveFrom,
+			EffectiveUntil: effectiveUntil,
+			Windows:        copyWindows(windows),
+		})
+	}
+
+	if len(schedules) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one weekday is required"})
+		return
+	}
+
+	if err := configuration.DB.Create(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save weekly schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Weekly schedule saved successfully",
+		"data":    schedules,
+	})
+}
+
+// ViewWeeklySchedule lists the weekly availability templates of a doctor
+func ViewWeeklySchedule(c *gin.Context) {
+	doctorID, ok := c.Get("doctor_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Doctor not authenticated"})
+		return
+	}
+
+	var schedules []models.DoctorWeeklySchedule
+	if err := configuration.DB.Preload("Windows").Where("doctor_id = ?", doctorID).Order("weekday, effective_from").Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weekly schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Weekly schedule fetched successfully",
+		"data":    schedules,
+	})
+}
+
+// RemoveWeeklySchedule deletes a weekly availability template of a doctor
+func RemoveWeeklySchedule(c *gin.Context) {
+	doctorID, ok := c.Get("doctor_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Doctor not authenticated"})
+		return
+	}
+
+	var record models.DoctorWeeklySchedule
+	if err := configuration.DB.Where("id = ? AND doctor_id = ?", c.Param("id"), doctorID).First(&record).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Weekly schedule not found"})
+		return
+	}
+
+	// Remove the availability windows along with the weekly schedule
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("weekly_schedule_id = ?", record.ID).Delete(&models.AvailabilityWindow{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&record).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove weekly schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Weekly schedule removed successfully",
+	})
+}
+
+// RemoveAvailability deletes a per-date availability so the weekly schedule applies again
+func RemoveAvailability(c *gin.Context) {
+	doctorID, ok := c.Get("doctor_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Doctor not authenticated"})
+		return
+	}
+
+	var record models.DoctorAvailability
+	if err := configuration.DB.Where("id = ? AND doctor_id = ?", c.Param("id"), doctorID).First(&record).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Availability not found"})
+		return
+	}
+
+	// Remove the availability windows along with the availability
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_availability_id = ?", record.ID).Delete(&models.AvailabilityWindow{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&record).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Availability removed successfully",
+	})
+}
+
+// AddBlackoutDate marks a date on which the doctor is not available
+func AddBlackoutDate(c *gin.Context) {
+	var blackoutRequest struct {
+		Date   string `json:"date" binding:"required"`
+		Reason string `json:"reason"`
+	}
+
+	if err := c.BindJSON(&blackoutRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	doctorID, ok := c.Get("doctor_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Doctor not authenticated"})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", blackoutRequest.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	// Check if the date is already blacked out
+	var existingBlackout models.DoctorBlackout
+	if err := configuration.DB.Where("doctor_id = ? AND date = ?", doctorID, date).First(&existingBlackout).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Blackout already exists for this date"})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check blackout dates"})
+		return
+	}
+
+	// Booked appointments have to be cancelled before the date can be blacked out
+	var bookedCount int64
+	if err := configuration.DB.Model(&models.Appointment{}).Where("doctor_id = ? AND appointment_date = ? AND booking_status IN (?, ?)", doctorID, date, models.BookingPending, models.BookingConfirmed).Count(&bookedCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check appointments"})
+		return
+	}
+	if bookedCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Appointments are already booked for this date, cancel them first"})
+		return
+	}
+
+	blackout := models.DoctorBlackout{
+		DoctorID: doctorID.(uint),
+		Date:     date,
+		Reason:   blackoutRequest.Reason,
+	}
+	if err := configuration.DB.Create(&blackout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add blackout date"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Blackout date added successfully",
+		"data":    blackout,
+	})
+}
+
+// ViewBlackoutDates lists the blackout dates of a doctor
+func ViewBlackoutDates(c *gin.Context) {
+	doctorID, ok := c.Get("doctor_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Doctor not authenticated"})
+		return
+	}
+
+	var blackouts []models.DoctorBlackout
+	if err := configuration.DB.Where("doctor_id = ?", doctorID).Order("date").Find(&blackouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blackout dates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Blackout dates fetched successfully",
+		"data":    blackouts,
+	})
+}
+
+// RemoveBlackoutDate deletes a blackout date of a doctor
+func RemoveBlackoutDate(c *gin.Context) {
+	doctorID, ok := c.Get("doctor_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Doctor not authenticated"})
+		return
+	}
+
+	result := configuration.DB.Where("id = ? AND doctor_id = ?", c.Param("id"), doctorID).Delete(&models.DoctorBlackout{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove blackout date"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blackout date not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Blackout date removed successfully",
+	})
+}
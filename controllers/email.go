@@ -1,18 +1,22 @@
 package controllers
 
 import (
+	"doc-connect/configuration"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/go-gomail/gomail"
 )
 
 // // SendEmail sends an email with an optional attachment
 func SendEmail(msg, email, attachmentName string, attachmentData []byte) error {
+	if !configuration.Settings.Features.EmailNotifications {
+		return nil
+	}
+
 	// SMTP server configuration
-	senderEmail := os.Getenv("Email")
-	senderPassword := os.Getenv("Password")
+	smtpConfig := configuration.Settings.SMTP
+	senderEmail := smtpConfig.Username
 
 	// Compose email message
 	m := gomail.NewMessage()
@@ -29,7 +33,7 @@ func SendEmail(msg, email, attachmentName string, attachmentData []byte) error {
 	}))
 
 	// Dial to SMTP server and send email
-	d := gomail.NewDialer("smtp.gmail.com", 587, senderEmail, senderPassword)
+	d := gomail.NewDialer(smtpConfig.Host, smtpConfig.Port, smtpConfig.Username, smtpConfig.Password)
 	if err := d.DialAndSend(m); err != nil {
 		return fmt.Errorf("error sending email: %v", err)
 	}
@@ -39,9 +43,13 @@ func SendEmail(msg, email, attachmentName string, attachmentData []byte) error {
 
 // // SendEmail sends an email with an optional attachment
 func SendInvoiceEmail(msg, email, attachmentName string, attachmentData []byte) error {
+	if !configuration.Settings.Features.EmailNotifications {
+		return nil
+	}
+
 	// SMTP server configuration
-	senderEmail := os.Getenv("Email")
-	senderPassword := os.Getenv("Password")
+	smtpConfig := configuration.Settings.SMTP
+	senderEmail := smtpConfig.Username
 
 	// Compose email message
 	m := gomail.NewMessage()
@@ -58,7 +66,7 @@ func SendInvoiceEmail(msg, email, attachmentName string, attachmentData []byte)
 	}))
 
 	// Dial to SMTP server and send email
-	d := gomail.NewDialer("smtp.gmail.com", 587, senderEmail, senderPassword)
+	d := gomail.NewDialer(smtpConfig.Host, smtpConfig.Port, smtpConfig.Username, smtpConfig.Password)
 	if err := d.DialAndSend(m); err != nil {
 		return fmt.Errorf("error sending email: %v", err)
 	}
@@ -68,9 +76,13 @@ func SendInvoiceEmail(msg, email, attachmentName string, attachmentData []byte)
 
 // // SendEmail sends an email with an optional attachment
 func SendPrescriptionEmail(msg, email, attachmentName string, attachmentData []byte) error {
+	if !configuration.Settings.Features.EmailNotifications {
+		return nil
+	}
+
 	// SMTP server configuration
-	senderEmail := os.Getenv("Email")
-	senderPassword := os.Getenv("Password")
+	smtpConfig := configuration.Settings.SMTP
+	senderEmail := smtpConfig.Username
 
 	// Compose email message
 	m := gomail.NewMessage()
@@ -87,7 +99,33 @@ func SendPrescriptionEmail(msg, email, attachmentName string, attachmentData []b
 	}))
 
 	// Dial to SMTP server and send email
-	d := gomail.NewDialer("smtp.gmail.com", 587, senderEmail, senderPassword)
+	d := gomail.NewDialer(smtpConfig.Host, smtpConfig.Port, smtpConfig.Username, smtpConfig.Password)
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+
+	return nil
+}
+
+// SendNotificationEmail sends a plain text email without attachment
+func SendNotificationEmail(subject, msg, email string) error {
+	if !configuration.Settings.Features.EmailNotifications {
+		return nil
+	}
+
+	// SMTP server configuration
+	smtpConfig := configuration.Settings.SMTP
+	senderEmail := smtpConfig.Username
+
+	// Compose email message
+	m := gomail.NewMessage()
+	m.SetHeader("From", senderEmail)
+	m.SetHeader("To", email)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/plain", msg)
+
+	// Dial to SMTP server and send email
+	d := gomail.NewDialer(smtpConfig.Host, smtpConfig.Port, smtpConfig.Username, smtpConfig.Password)
 	if err := d.DialAndSend(m); err != nil {
 		return fmt.Errorf("error sending email: %v", err)
 	}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"doc-connect/authentication"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// AddHospitalStaff creates a front desk account for a hospital and emails the staff member a
+// link to set their password with
+func AddHospitalStaff(c *gin.Context) {
+	var staffRequest struct {
+		HospitalID uint   `json:"hospital_id" binding:"required"`
+		Name       string `json:"name" binding:"required"`
+		Email      string `json:"email" binding:"required,email"`
+	}
+	if err := c.BindJSON(&staffRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var hospital models.Hospital
+	if err := configuration.DB.Where("id = ? AND status = ?", staffRequest.HospitalID, "Active").First(&hospital).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hospital not found"})
+		return
+	}
+
+	staff := models.HospitalStaff{
+		HospitalID: hospital.ID,
+		Name:       staffRequest.Name,
+		Email:      staffRequest.Email,
+		Status:     models.StaffInvited,
+	}
+	token, err := newPasswordToken(&staff.PasswordTokenHash, &staff.PasswordTokenExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	if err := configuration.DB.Create(&staff).Error; errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create staff account"})
+		return
+	}
+
+	sendPasswordLink(staff.Name, staff.Email, "/staff/set/password", token, "You have been added as staff of "+hospital.Name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Staff added, the invite link was emailed to " + staff.Email,
+		"data":    staff,
+	})
+}
+
+// ViewHospitalStaff lists the staff accounts of a hospital
+func ViewHospitalStaff(c *gin.Context) {
+	var staff []models.HospitalStaff
+	if err := configuration.DB.Where("hospital_id = ?", c.Param("id")).Order("staff_id").Find(&staff).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch staff"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Staff fetched successfully",
+		"data":    staff,
+	})
+}
+
+// DisableHospitalStaff blocks a staff account and signs it out everywhere
+func DisableHospitalStaff(c *gin.Context) {
+	staff, ok := updateHospitalStaff(c, func(tx *gorm.DB, staff *models.HospitalStaff) error {
+		staff.Status = models.StaffDisabled
+		return tx.Model(staff).Update("status", staff.Status).Error
+	})
+	if !ok {
+		return
+	}
+	if err := authentication.RevokeAllSessions(models.RoleHospitalStaff, strconv.FormatUint(uint64(staff.StaffID), 10)); err != nil {
+		log.Println("Failed to revoke sessions of disabled staff:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Staff disabled successfully",
+		"data":    staff,
+	})
+}
+
+// EnableHospitalStaff unblocks a disabled staff account. Staff that never set a password stay
+// invited.
+func EnableHospitalStaff(c *gin.Context) {
+	staff, ok := updateHospitalStaff(c, func(tx *gorm.DB, staff *models.HospitalStaff) error {
+		if staff.Status != models.StaffDisabled {
+			return nil
+		}
+		staff.Status = models.StaffActive
+		if staff.Password == "" {
+			staff.Status = models.StaffInvited
+		}
+		return tx.Model(staff).Update("status", staff.Status).Error
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Staff enabled successfully",
+		"data":    staff,
+	})
+}
+
+// ResetHospitalStaffPassword emails a staff member a link to set a new password with
+func ResetHospitalStaffPassword(c *gin.Context) {
+	var token string
+	staff, ok := updateHospitalStaff(c, func(tx *gorm.DB, staff *models.HospitalStaff) error {
+		var err error
+		if token, err = newPasswordToken(&staff.PasswordTokenHash, &staff.PasswordTokenExpiresAt); err != nil {
+			return err
+		}
+		return tx.Model(staff).Updates(map[string]interface{}{
+			"password_token_hash":       staff.PasswordTokenHash,
+			"password_token_expires_at": staff.PasswordTokenExpiresAt,
+		}).Error
+	})
+	if !ok {
+		return
+	}
+
+	sendPasswordLink(staff.Name, staff.Email, "/staff/set/password", token, "A password reset was requested for your staff account")
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Password reset link was emailed to " + staff.Email,
+	})
+}
+
+// SetStaffPassword sets the password of a staff member with the token of an invite or reset
+// link. An invited staff member becomes active, and all their sessions are signed out.
+func SetStaffPassword(c *gin.Context) {
+	var passwordRequest struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+	if err := c.BindJSON(&passwordRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var staff models.HospitalStaff
+	if err := configuration.DB.Where("password_token_hash = ? AND password_token_expires_at > ?", authentication.HashToken(passwordRequest.Token), time.Now()).
+		First(&staff).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if staff.Status == models.StaffDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff account is disabled"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordRequest.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// The token can be used once
+	result := configuration.DB.Model(&models.HospitalStaff{}).Where("staff_id = ? AND password_token_hash = ?", staff.StaffID, staff.PasswordTokenHash).
+		Updates(map[string]interface{}{
+			"password":                  string(hashedPassword),
+			"status":                    models.StaffActive,
+			"password_token_hash":       "",
+			"password_token_expires_at": nil,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if err := authentication.RevokeAllSessions(models.RoleHospitalStaff, strconv.FormatUint(uint64(staff.StaffID), 10)); err != nil {
+		log.Println("Failed to revoke sessions after password change:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Password set successfully, please log in",
+	})
+}
+
+// StaffLogin signs in hospital staff
+func StaffLogin(c *gin.Context) {
+	var loginRequest struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.BindJSON(&loginRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var staff models.HospitalStaff
+	if err := configuration.DB.Where("email = ?", loginRequest.Email).First(&staff).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(staff.Password), []byte(loginRequest.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if staff.Status != models.StaffActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff account is " + staff.Status})
+		return
+	}
+
+	tokens, err := authentication.StartSession(c, models.RoleHospitalStaff, strconv.FormatUint(uint64(staff.StaffID), 10), staff.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": tokens.AccessToken, "refresh_token": tokens.RefreshToken, "expires_in": tokens.ExpiresIn})
+}
+
+// StaffLogout ends the current session of a staff member
+func StaffLogout(c *gin.Context) {
+	if err := endCurrentSession(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
+}
+
+// updateHospitalStaff changes the staff account of the id parameter, responding with an error
+// if it fails
+func updateHospitalStaff(c *gin.Context, update func(tx *gorm.DB, staff *models.HospitalStaff) error) (models.HospitalStaff, bool) {
+	var staff models.HospitalStaff
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&staff, c.Param("id")).Error; err != nil {
+			return err
+		}
+		return update(tx, &staff)
+	})
+
+	switch {
+	case err == nil:
+		return staff, true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update staff"})
+	}
+	return staff, false
+}
@@ -2,26 +2,29 @@ package controllers
 
 import (
 	"bytes"
+	"doc-connect/access"
 	"doc-connect/configuration"
 	"doc-connect/models"
+	"doc-connect/money"
+	"doc-connect/payments"
 	"errors"
 	"fmt"
+	"log"
 
 	// "fmt"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jung-kurt/gofpdf"
-	"github.com/razorpay/razorpay-go"
 	"gorm.io/gorm"
 )
 
 func GetInvoice(c *gin.Context) {
 	var invoice []models.Invoice
-	if err := configuration.DB.Find(&invoice).Error; err != nil {
+	if err := configuration.DB.Preload("Items").Preload("Payments").Find(&invoice).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Error occured while receiving the invoice",
 		})
@@ -43,36 +46,40 @@ func PayInvoiceOffline(c *gin.Context) {
 	}
 
 	var invoice models.Invoice
-	if err := configuration.DB.Where("invoice_id = ?", paymentRequest.InvoiceID).First(&invoice).Error; err != nil {
+	if err := configuration.DB.Preload("Items").Where("invoice_id = ?", paymentRequest.InvoiceID).First(&invoice).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
 		return
 	}
+	if !authorized(c, access.Invoice(configuration.DB, principal(c), invoice)) {
+		return
+	}
 
-	if invoice.PaymentStatus == "Paid" {
+	if invoice.PaymentStatus == models.InvoicePaid {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invoice already paid"})
 		return
 	}
 
-	// Update payment status to "Paid" for offline payment
-	invoice.PaymentStatus = "Paid"
-	invoice.PaymentMethod = "Offline"
-	if err := configuration.DB.Save(&invoice).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status"})
+	// The slot is released once the payment window passes
+	if paymentWindowExpired(invoice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment window has expired, please book again"})
 		return
 	}
 
-	// Update corresponding appointment status
-	var appointment models.Appointment
-	if err := configuration.DB.Where("appointment_id = ?", invoice.AppointmentID).First(&appointment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointment"})
+	// Patients with repeated no-shows have to prepay
+	if invoice.PrepaymentRequired {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This invoice has to be paid online or from the wallet"})
 		return
 	}
 
-	// Update appointment status to "confirmed" and payment status to "paid"
-	appointment.BookingStatus = "confirmed"
-	appointment.PaymentStatus = "paid"
-	if err := configuration.DB.Save(&appointment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment status"})
+	// Mark the invoice as paid offline and confirm the appointment
+	var appointment models.Appointment
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		appointment, err = markInvoicePaid(tx, &invoice, "Offline", actorFromContext(c))
+		return err
+	})
+	if err != nil {
+		transitionError(c, err)
 		return
 	}
 
@@ -143,56 +150,54 @@ func MakePaymentOnline(c *gin.Context) {
 	}
 
 	// Check if the invoice is already paid
-	if invoice.PaymentStatus == "Paid" {
+	if invoice.PaymentStatus == models.InvoicePaid {
 		c.JSON(400, gin.H{"error": "Invoice is already paid"})
 		return
 	}
 
-	// Create a RazorPay payment record in the database with the invoice ID and total amount.
-	razorpayment := &models.RazorPay{
-		InvoiceID:  uint(invoice.InvoiceID),
-		AmountPaid: invoice.TotalAmount,
-	}
-
-	razorpayment.RazorPaymentID = generateUniqueID()
-	if err := configuration.DB.Create(&razorpayment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create razor payment"})
+	// The slot is released once the payment window passes
+	if paymentWindowExpired(invoice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment window has expired, please book again"})
 		return
 	}
 
-	// Convert total amount to paisa (multiply by 100) for RazorPay API
-	amountInPaisa := invoice.TotalAmount * 100
-	razorpayClient := razorpay.NewClient(os.Getenv("RazorPay_key_id"), os.Getenv("RazorPay_key_secret"))
-
-	// Prepare data for creating a RazorPay order.
-	data := map[string]interface{}{
-		"amount":   amountInPaisa,
-		"currency": "INR",
-		"receipt":  "some_receipt_id",
-	}
-
-	// Create a RazorPay order using the RazorPay API
-	body, err := razorpayClient.Order.Create(data, nil)
+	provider := configuration.PaymentProvider
 
+	// Create an order with the payment provider for what is left to pay, the wallet may have
+	// paid a part
+	order, err := provider.CreateOrder(invoice.Outstanding(), fmt.Sprintf("invoice_%d", invoice.InvoiceID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Faied to create razorpay orer"})
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create payment order"})
+		return
 	}
 
-	// Extract the order ID from the response body returned by the RazorPay API
-	value := body["id"]
-	str := value.(string)
+	// Record the attempt, the payment id follows once checkout reports it
+	attempt := models.PaymentAttempt{
+		InvoiceID:       invoice.InvoiceID,
+		Provider:        provider.Name(),
+		ProviderOrderID: order.ID,
+		Amount:          order.Amount.Amount,
+		Currency:        order.Amount.Currency,
+		Status:          models.PaymentAttemptCreated,
+	}
+	if err := configuration.DB.Create(&attempt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment attempt"})
+		return
+	}
 
 	// Create an instance of the PageVariable struct to hold data for the HTML template
 	homepagevariables := PageVariable{
-		AppointmentID: str,
+		AppointmentID: order.ID,
 	}
 
 	// Render the payment.html template, passing invoice ID, total price, total amount, and appointment ID as template variables.
 	c.HTML(http.StatusOK, "payment.html", gin.H{
 		"invoiceID":     id,
-		"totalPrice":    amountInPaisa / 100,
-		"total":         amountInPaisa,
+		"totalPrice":    order.Amount.Amount,
+		"total":         order.Amount.Amount.Minor(),
+		"currency":      invoice.Currency,
 		"appointmentID": homepagevariables.AppointmentID,
+		"provider":      provider.Name(),
 	})
 }
 
@@ -203,109 +208,131 @@ func generateUniqueID() string {
 	return id.String()
 }
 
-// Function to display success page after successfull payment
+// Function to display success page after successfull payment. The payment reported by
+// checkout is only accepted with a valid provider signature for an order of the invoice.
 func SuccessPage(c *gin.Context) {
-	paymentID := c.Query("bookID")
-	fmt.Println(paymentID)
+	invoiceID := c.Query("bookID")
+	orderID := c.Query("order_id")
+	paymentID := c.Query("payment_id")
 
 	// Fetch the invoice corresponding to the provided payment ID from the database
 	var invoice models.Invoice
-	if err := configuration.DB.First(&invoice, paymentID).Error; err != nil {
+	if err := configuration.DB.Preload("Items").First(&invoice, invoiceID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"Error": "Failed to fetch the invoice",
 		})
 		return
 	}
-	fmt.Printf("%+v\n", invoice)
 
-	if invoice.PaymentStatus == "Pending" {
-		if err := configuration.DB.Model(&invoice).Update("payment_status", "Paid").Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"Error": "Failed to update the invoice paymet status",
-			})
-			return
-		}
+	// Only the provider can sign the order and payment with our key secret
+	provider := configuration.PaymentProvider
+	if orderID == "" || paymentID == "" || !provider.VerifyPayment(orderID, paymentID, c.Query("signature")) {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Payment verification failed"})
+		return
 	}
 
-	// Update payment method to "online"
-	if err := configuration.DB.Model(&invoice).Update("payment_method", "online").Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"Error": "Failed to update the payment method",
-		})
+	// Check if the order was created for this invoice
+	var attempt models.PaymentAttempt
+	if err := configuration.DB.Where("invoice_id = ? AND provider = ? AND provider_order_id = ?", invoice.InvoiceID, provider.Name(), orderID).First(&attempt).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Payment does not belong to this invoice"})
 		return
 	}
 
-	// Create a record of the RazorPay payment in the database
-	razorPayment := models.RazorPay{
-		InvoiceID:      uint(invoice.InvoiceID),
-		RazorPaymentID: generateUniqueID(),
-		AmountPaid:     invoice.TotalAmount,
+	// The payment settles the invoice, unless the webhook already did, or is refunded when it can't
+	var captured capturedOnlinePayment
+	if err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		captured, err = applyCapturedPayment(tx, attempt, paymentID, money.New(attempt.Amount, attempt.Currency))
+		return err
+	}); err != nil {
+		transitionError(c, err)
+		return
 	}
+	invoice = captured.Invoice
 
-	if err := configuration.DB.Create(&razorPayment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"Error": "Failed to create RazorPay Payment",
-		})
+	if refund := captured.Refund; refund != nil {
+		if refund.Status == models.RefundPending && refund.GatewayRefundID == "" {
+			if err := issueGatewayRefund(refund); err != nil {
+				log.Printf("Failed to issue refund %d, the reconcile job retries it: %v\n", refund.ID, err)
+			}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"Error": captured.Reason + ", the payment is refunded"})
+		return
 	}
 
-	// Update appointment status in appointment table
-	if invoice.AppointmentID != 0 {
-		if err := configuration.DB.Model(&models.Appointment{}).Where("appointment_id = ?", invoice.AppointmentID).Updates(map[string]interface{}{"booking_status": "confirmed", "payment_status": "paid"}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"Error": "Failed to update the appointment status",
-			})
+	// Send payment confirmation email with PDF invoice attached
+	if captured.Paid {
+		if err := sendPaymentConfirmation(invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
 			return
 		}
 	}
 
-	// bookingID := c.Query("appointmentID")
-	// fmt.Println("bookidi",bookingID)
-	var booking models.Appointment
-	if err := configuration.DB.First(&booking, invoice.AppointmentID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch booking details"})
+	// Render the success page template, passing payment ID, amount paid, and invoice ID as template variables
+	c.HTML(http.StatusOK, "success.html", gin.H{
+		"paymentID":  paymentID,
+		"amountPaid": invoice.Total(),
+		"invoiceID":  invoice.InvoiceID,
+	})
+}
+
+// FakeCheckout completes the checkout of an order when the fake payment provider is configured
+// and continues to the success page like the provider's checkout would
+func FakeCheckout(c *gin.Context) {
+	fake, ok := configuration.PaymentProvider.(*payments.Fake)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fake checkout is not enabled"})
 		return
 	}
 
-	// Fetch doctor and patient details based on the booking
-	var doctor models.Doctor
-	if err := configuration.DB.First(&doctor, booking.DoctorID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch doctor details"})
+	orderID := c.Query("order_id")
+	paymentID, signature, err := fake.Pay(orderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown order"})
 		return
 	}
 
-	var patient models.Patient
-	if err := configuration.DB.First(&patient, booking.PatientID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch patient details"})
-		return
+	params := url.Values{
+		"payment_id": {paymentID},
+		"order_id":   {orderID},
+		"signature":  {signature},
 	}
 
-	// Generate PDF invoice
-	pdfInvoice, err := GeneratePaidPDFInvoice(booking, invoice, doctor, patient)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF invoice"})
+	// Wallet top-ups have their own success page
+	if _, ok, _ := topUpOfOrder(configuration.DB, fake.Name(), orderID); ok {
+		c.Redirect(http.StatusFound, "/wallet/topup/success?"+params.Encode())
 		return
 	}
 
-	//Update corresponding appointment status
+	params.Set("bookID", c.Query("bookID"))
+	c.Redirect(http.StatusFound, "/payment/success?"+params.Encode())
+}
+
+// sendPaymentConfirmation emails the patient the paid invoice as PDF
+func sendPaymentConfirmation(invoice models.Invoice) error {
 	var appointment models.Appointment
-	if err := configuration.DB.Where("appointment_id = ?", invoice.AppointmentID).First(&appointment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointment"})
-		return
+	if err := configuration.DB.First(&appointment, invoice.AppointmentID).Error; err != nil {
+		return err
 	}
 
-	// Send payment confirmation email with PDF invoice attached
-	err = SendInvoiceEmail("Payment successful for invoice", appointment.PatientEmail, "invoice.pdf", pdfInvoice)
+	// Fetch doctor and patient details based on the booking
+	var doctor models.Doctor
+	if err := configuration.DB.First(&doctor, appointment.DoctorID).Error; err != nil {
+		return err
+	}
+
+	var patient models.Patient
+	if err := configuration.DB.First(&patient, appointment.PatientID).Error; err != nil {
+		return err
+	}
+
+	// Generate PDF invoice
+	pdfInvoice, err := GeneratePaidPDFInvoice(appointment, invoice, doctor, patient)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
-		return
+		return err
 	}
 
-	// Render the success page template, passing payment ID, amount paid, and invoice ID as template variables
-	c.HTML(http.StatusOK, "success.html", gin.H{
-		"paymentID":  razorPayment.RazorPaymentID,
-		"amountPaid": invoice.TotalAmount,
-		"invoiceID":  invoice.InvoiceID,
-	})
+	return SendInvoiceEmail("Payment successful for invoice", appointment.PatientEmail, "invoice.pdf", pdfInvoice)
 }
 
 // generateDuePDFInvoice generates a professional PDF invoice for appointment dues
@@ -343,13 +370,11 @@ func GeneratePaidPDFInvoice(booking models.Appointment, invoice models.Invoice,
 	add2Detail(pdf, "Booking Status", booking.BookingStatus, false)
 	add2Detail(pdf, "Due date", invoice.PaymentDueDate.Format("2006-01-02"), false)
 	add2Detail(pdf, "Paid date", invoice.UpdatedAt.Format("2006-01-02"), false)
-	// CGST and SGST (0)
-	add2Detail(pdf, "CGST (0%)", "0.00", false)
-	add2Detail(pdf, "SGST (0%)", "0.00", false)
+	addInvoiceLines(pdf, invoice)
 	pdf.SetFont("Arial", "B", 13)
-	add2Detail(pdf, "Grand Total", fmt.Sprintf("%.2f", invoice.TotalAmount), true)
+	add2Detail(pdf, "Grand Total", invoice.Total().String(), true)
 	pdf.SetTextColor(139, 128, 0) // Yellow color for total amount
-	add2Detail(pdf, "Amount Paid", fmt.Sprintf("%.2f", invoice.TotalAmount), true)
+	add2Detail(pdf, "Amount Paid", invoice.Total().String(), true)
 
 	// Payment instructions
 	pdf.SetTextColor(0, 0, 0) // Reset text color to black
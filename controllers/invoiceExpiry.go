@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExpireOverdueInvoices expires every pending or partially paid invoice past its due date,
+// cancels its booking to free the slot and emails the patient. It returns the number of invoices expired.
+func ExpireOverdueInvoices() (int, error) {
+	var invoices []models.Invoice
+	if err := configuration.DB.Where("payment_status IN ? AND payment_due_date < ?", invoicePayableStatuses, time.Now()).Find(&invoices).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	var errs []error
+	for _, invoice := range invoices {
+		var appointment models.Appointment
+		var cancelled bool
+		if err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.First(&appointment, invoice.AppointmentID).Error; err != nil {
+				return err
+			}
+			var err error
+			cancelled, err = expireBooking(tx, &appointment)
+			return err
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to expire invoice %d: %w", invoice.InvoiceID, err))
+			continue
+		}
+		// The invoice was paid or the booking cancelled since it was read
+		if !cancelled {
+			continue
+		}
+		expired++
+
+		// Offer the freed slot to the waitlist
+		offerFreedSlot(appointment.DoctorID, appointment.AppointmentDate, appointment.AppointmentTimeSlot)
+
+		// Let the patient know the slot has been released
+		msg := fmt.Sprintf("Your appointment #%d on %s (%s) has been cancelled because invoice #%d was not paid by %s. Please book again if you still need the consultation.",
+			appointment.AppointmentID, appointment.AppointmentDate.Format("2006-01-02"), appointment.AppointmentTimeSlot,
+			invoice.InvoiceID, invoice.PaymentDueDate.Format("2006-01-02 15:04"))
+		if err := SendNotificationEmail("Appointment cancelled - payment not received", msg, appointment.PatientEmail); err != nil {
+			log.Println("Failed to send invoice expiry email:", err)
+		}
+	}
+	return expired, errors.Join(errs...)
+}
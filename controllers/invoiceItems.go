@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"doc-connect/billing"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"gorm.io/gorm"
+)
+
+// newInvoiceItem creates a line item taxed at the configured rate of its kind
+func newInvoiceItem(kind, description string, quantity int, unitPrice, discount money.Amount) models.InvoiceItem {
+	item := models.InvoiceItem{
+		Kind:        kind,
+		Description: description,
+		Quantity:    quantity,
+		UnitPrice:   unitPrice,
+		Discount:    discount,
+		TaxRate:     configuration.TaxRate(kind),
+	}
+	billing.PriceItem(&item)
+	return item
+}
+
+// bookingInvoiceItems are the line items of a new appointment invoice: the consultation
+// fee of the doctor and the platform fee
+func bookingInvoiceItems(doctor models.Doctor) []models.InvoiceItem {
+	items := []models.InvoiceItem{
+		newInvoiceItem(models.InvoiceItemConsultation, "Consultation with "+doctor.Name, 1, money.FromMajor(float64(doctor.ConsultancyCharge)), 0),
+	}
+	if fee := configuration.PlatformFee(); fee > 0 {
+		items = append(items, newInvoiceItem(models.InvoiceItemPlatformFee, "Platform fee", 1, fee, 0))
+	}
+	return items
+}
+
+// totalInvoice prices the items of an invoice and totals it with the configured rounding
+func totalInvoice(invoice *models.Invoice) {
+	billing.Total(invoice, configuration.InvoiceRounding() == configuration.RoundToRupee)
+}
+
+// retotalInvoice recomputes the totals of a pending invoice after its items changed
+func retotalInvoice(tx *gorm.DB, invoice *models.Invoice) error {
+	if err := tx.Where("invoice_id = ?", invoice.InvoiceID).Order("id").Find(&invoice.Items).Error; err != nil {
+		return err
+	}
+	totalInvoice(invoice)
+
+	result := tx.Model(&models.Invoice{}).
+		Where("invoice_id = ? AND payment_status = ?", invoice.InvoiceID, models.InvoicePending).
+		Updates(map[string]interface{}{
+			"subtotal":            invoice.Subtotal,
+			"discount_amount":     invoice.DiscountAmount,
+			"tax_amount":          invoice.TaxAmount,
+			"rounding_adjustment": invoice.RoundingAdjustment,
+			"total_amount":        invoice.TotalAmount,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvoiceNotPayable
+	}
+	return nil
+}
+
+// pendingInvoiceOfDoctor fetches a pending invoice of the authenticated doctor, responding
+// with an error if there is none
+func pendingInvoiceOfDoctor(c *gin.Context, invoiceID interface{}) (models.Invoice, bool) {
+	var invoice models.Invoice
+	doctorID, _ := c.Get("doctor_id")
+	if err := configuration.DB.Where("invoice_id = ? AND doctor_id = ?", invoiceID, doctorID).First(&invoice).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return invoice, false
+	}
+	if invoice.PaymentStatus != models.InvoicePending || paymentWindowExpired(invoice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending invoices can be changed"})
+		return invoice, false
+	}
+	return invoice, true
+}
+
+// AddInvoiceItem adds a lab test or procedure to a pending invoice of the doctor
+func AddInvoiceItem(c *gin.Context) {
+	var itemRequest struct {
+		Kind        string       `json:"kind" binding:"required"`
+		Description string       `json:"description" binding:"required"`
+		Quantity    int          `json:"quantity" binding:"min=0"`
+		UnitPrice   money.Amount `json:"unit_price" binding:"gt=0"`
+		Discount    money.Amount `json:"discount" binding:"min=0"`
+	}
+
+	if err := c.BindJSON(&itemRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if itemRequest.Kind != models.InvoiceItemLabTest && itemRequest.Kind != models.InvoiceItemProcedure {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be lab_test or procedure"})
+		return
+	}
+
+	invoice, ok := pendingInvoiceOfDoctor(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	item := newInvoiceItem(itemRequest.Kind, itemRequest.Description, itemRequest.Quantity, itemRequest.UnitPrice, itemRequest.Discount)
+	item.InvoiceID = invoice.InvoiceID
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return retotalInvoice(tx, &invoice)
+	})
+	if errors.Is(err, errInvoiceNotPayable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending invoices can be changed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add invoice item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Invoice item added successfully",
+		"data":    invoice,
+	})
+}
+
+// RemoveInvoiceItem removes a lab test or procedure from a pending invoice of the doctor
+func RemoveInvoiceItem(c *gin.Context) {
+	var item models.InvoiceItem
+	if err := configuration.DB.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice item not found"})
+		return
+	}
+	if item.Kind != models.InvoiceItemLabTest && item.Kind != models.InvoiceItemProcedure {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only lab tests and procedures can be removed"})
+		return
+	}
+
+	invoice, ok := pendingInvoiceOfDoctor(c, item.InvoiceID)
+	if !ok {
+		return
+	}
+
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&item).Error; err != nil {
+			return err
+		}
+		return retotalInvoice(tx, &invoice)
+	})
+	if errors.Is(err, errInvoiceNotPayable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending invoices can be changed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove invoice item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Invoice item removed successfully",
+		"data":    invoice,
+	})
+}
+
+// addInvoiceLines adds the line items and totals of an invoice to a PDF invoice
+func addInvoiceLines(pdf *gofpdf.Fpdf, invoice models.Invoice) {
+	pdf.SetFont("Arial", "B", 10)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.CellFormat(80, 8, "Item", "1", 0, "", false, 0, "")
+	pdf.CellFormat(15, 8, "Qty", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(25, 8, "Unit price", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(20, 8, "Discount", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(25, 8, "GST", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 8, "Amount", "1", 1, "R", false, 0, "")
+
+	pdf.SetFont("Arial", "", 10)
+	for _, item := range invoice.Items {
+		pdf.CellFormat(80, 8, item.Description, "1", 0, "", false, 0, "")
+		pdf.CellFormat(15, 8, fmt.Sprintf("%d", item.Quantity), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 8, item.UnitPrice.String(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(20, 8, item.Discount.String(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 8, fmt.Sprintf("%s (%g%%)", item.TaxAmount, item.TaxRate), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(0, 8, item.Amount.String(), "1", 1, "R", false, 0, "")
+	}
+
+	cgst, sgst := billing.SplitGST(invoice.TaxAmount)
+	addDetail(pdf, "Subtotal", invoice.Subtotal.String(), false)
+	discountLabel := "Discount"
+	if invoice.CouponCode != "" {
+		discountLabel = "Discount (" + invoice.CouponCode + ")"
+	}
+	addDetail(pdf, discountLabel, (-invoice.DiscountAmount).String(), false)
+	addDetail(pdf, "CGST", cgst.String(), false)
+	addDetail(pdf, "SGST", sgst.String(), false)
+	addDetail(pdf, "Rounding", invoice.RoundingAdjustment.String(), false)
+}
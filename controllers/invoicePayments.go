@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"doc-connect/ledger"
+	"doc-connect/models"
+	"doc-connect/money"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// invoicePayableStatuses are the statuses of invoices that still wait for (the rest of) their payment
+var invoicePayableStatuses = []string{models.InvoicePending, models.InvoicePartiallyPaid}
+
+// awaitingPayment reports whether an invoice still waits for (the rest of) its payment
+func awaitingPayment(invoice models.Invoice) bool {
+	return invoice.PaymentStatus == models.InvoicePending || invoice.PaymentStatus == models.InvoicePartiallyPaid
+}
+
+// invoicePaymentKey is the idempotency key of a wallet payment towards an invoice. The amount
+// already paid tells apart the payments of an invoice paid in several parts.
+func invoicePaymentKey(invoice models.Invoice) string {
+	return fmt.Sprintf("payment:invoice:%d:%d", invoice.InvoiceID, invoice.AmountPaid.Minor())
+}
+
+// applyWalletPayment pays part of the outstanding amount of an invoice from the patient's wallet.
+// The invoice is partially paid until the rest is paid with another method.
+func applyWalletPayment(tx *gorm.DB, invoice *models.Invoice, amount money.Amount, idempotencyKey string) error {
+	if amount <= 0 || amount >= invoice.Outstanding().Amount {
+		return fmt.Errorf("partial payment of %s doesn't fit the outstanding %s", amount, invoice.Outstanding())
+	}
+
+	result := tx.Model(&models.Invoice{}).
+		Where("invoice_id = ? AND payment_status IN ? AND total_amount = ? AND amount_paid = ?",
+			invoice.InvoiceID, invoicePayableStatuses, invoice.TotalAmount, invoice.AmountPaid).
+		Updates(map[string]interface{}{
+			"payment_status": models.InvoicePartiallyPaid,
+			"payment_method": "wallet",
+			"amount_paid":    gorm.Expr("amount_paid + ?", amount),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvoiceNotPayable
+	}
+
+	if _, err := ledger.Debit(tx, ledger.Entry{
+		UserID:         int(invoice.PatientID),
+		Amount:         money.New(amount, invoice.Currency),
+		Reason:         models.WalletReasonInvoicePayment,
+		Description:    fmt.Sprintf("Part payment of invoice %d", invoice.InvoiceID),
+		InvoiceID:      invoice.InvoiceID,
+		AppointmentID:  int(invoice.AppointmentID),
+		IdempotencyKey: idempotencyKey,
+	}); err != nil {
+		return err
+	}
+
+	payment := models.InvoicePayment{
+		InvoiceID: invoice.InvoiceID,
+		Method:    "wallet",
+		Amount:    amount,
+		Currency:  invoice.Currency,
+		Status:    models.InvoicePaymentApplied,
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return err
+	}
+	invoice.PaymentStatus = models.InvoicePartiallyPaid
+	invoice.PaymentMethod = "wallet"
+	invoice.AmountPaid += amount
+	invoice.Payments = append(invoice.Payments, payment)
+	return nil
+}
+
+// reverseWalletPayments credits the wallet part of a partially paid invoice back to the wallet
+// when the rest wasn't paid, e.g. the online payment failed or the payment window expired. The
+// invoice is pending its whole total again.
+func reverseWalletPayments(tx *gorm.DB, invoice *models.Invoice) error {
+	var payments []models.InvoicePayment
+	if err := tx.Where("invoice_id = ? AND method = ? AND status = ?", invoice.InvoiceID, "wallet", models.InvoicePaymentApplied).
+		Find(&payments).Error; err != nil {
+		return err
+	}
+
+	result := tx.Model(&models.Invoice{}).
+		Where("invoice_id = ? AND payment_status = ? AND amount_paid = ?", invoice.InvoiceID, models.InvoicePartiallyPaid, invoice.AmountPaid).
+		Updates(map[string]interface{}{"payment_status": models.InvoicePending, "payment_method": "Pending", "amount_paid": 0})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvoiceNotPayable
+	}
+
+	for _, payment := range payments {
+		if err := tx.Model(&payment).Update("status", models.InvoicePaymentReversed).Error; err != nil {
+			return err
+		}
+		if _, err := ledger.Credit(tx, ledger.Entry{
+			UserID:         int(invoice.PatientID),
+			Amount:         money.New(payment.Amount, payment.Currency),
+			Reason:         models.WalletReasonReversal,
+			Description:    fmt.Sprintf("Reversal of part payment of invoice %d", invoice.InvoiceID),
+			InvoiceID:      invoice.InvoiceID,
+			AppointmentID:  int(invoice.AppointmentID),
+			IdempotencyKey: fmt.Sprintf("reversal:invoice-payment:%d", payment.ID),
+		}); err != nil {
+			return err
+		}
+	}
+
+	invoice.PaymentStatus = models.InvoicePending
+	invoice.PaymentMethod = "Pending"
+	invoice.AmountPaid = 0
+	return nil
+}
+
+// capturedOnlinePayment is what became of a payment captured for an order of an invoice
+type capturedOnlinePayment struct {
+	Invoice models.Invoice
+	Paid    bool           // the payment settled the invoice
+	Refund  *models.Refund // the payment couldn't settle the invoice and is refunded
+	Reason  string         // why the payment is refunded or had no effect
+}
+
+// applyCapturedPayment settles an invoice with a payment captured for one of its orders.
+// Checkout and the webhook both report a payment, it is applied by whichever comes first. A
+// payment that can't settle the invoice, because the invoice is no longer awaiting payment,
+// its payment window expired or its amount changed, is queued for a refund to its source.
+func applyCapturedPayment(tx *gorm.DB, attempt models.PaymentAttempt, paymentID string, paid money.Money) (capturedOnlinePayment, error) {
+	var captured capturedOnlinePayment
+
+	// The invoice is locked so it can't expire or be paid otherwise while the payment is applied
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").
+		First(&captured.Invoice, attempt.InvoiceID).Error; err != nil {
+		return captured, err
+	}
+
+	first, err := recordCapture(tx, attempt.ID, paymentID)
+	if err != nil {
+		return captured, err
+	}
+	if !first {
+		// Whoever applied it first settled the invoice or refunded the payment
+		var refund models.Refund
+		err := tx.Where("provider = ? AND provider_payment_id = ? AND destination = ?", attempt.Provider, paymentID, models.RefundToSource).
+			First(&refund).Error
+		if err == nil {
+			captured.Refund = &refund
+			captured.Reason = "Payment could not be applied"
+			return captured, nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return captured, err
+		}
+		captured.Reason = "Payment was already processed"
+		return captured, nil
+	}
+
+	invoice := &captured.Invoice
+	switch {
+	case !awaitingPayment(*invoice):
+		captured.Reason = "Invoice is already " + invoice.PaymentStatus
+	case paymentWindowExpired(*invoice):
+		captured.Reason = "Payment window has expired"
+	case paid != invoice.Outstanding():
+		// Items may have been added or a wallet part reversed after the order was created
+		captured.Reason = "Invoice amount has changed"
+	}
+	if captured.Reason != "" {
+		refund, err := queueSourceRefund(tx, invoice.InvoiceID, attempt.Provider, paymentID, paid)
+		if err != nil {
+			return captured, err
+		}
+		captured.Refund = &refund
+		return captured, nil
+	}
+
+	if _, err := markInvoicePaid(tx, invoice, "online", "system"); err != nil {
+		return captured, err
+	}
+	captured.Paid = true
+	return captured, nil
+}
+
+// recordCapture stores the captured payment of a payment attempt. It reports whether this is
+// the first time the payment is reported; a different payment captured for an order already
+// captured is new too, it is not stored over the first one.
+func recordCapture(tx *gorm.DB, attemptID uint, paymentID string) (bool, error) {
+	result := tx.Model(&models.PaymentAttempt{}).
+		Where("id = ? AND status <> ?", attemptID, models.PaymentAttemptCaptured).
+		Updates(map[string]interface{}{"provider_payment_id": paymentID, "status": models.PaymentAttemptCaptured})
+	if result.Error != nil || result.RowsAffected == 1 {
+		return result.RowsAffected == 1, result.Error
+	}
+
+	var attempt models.PaymentAttempt
+	if err := tx.First(&attempt, attemptID).Error; err != nil {
+		return false, err
+	}
+	return attempt.ProviderPaymentID != paymentID, nil
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJobRuns lists the most recent runs of the background jobs
+func GetJobRuns(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	query := configuration.DB.Order("started_at DESC").Limit(limit)
+	if jobName := c.Query("job"); jobName != "" {
+		query = query.Where("job_name = ?", jobName)
+	}
+
+	var runs []models.JobRun
+	if err := query.Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Job runs fetched successfully",
+		"data":    runs,
+	})
+}
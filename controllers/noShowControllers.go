@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/lifecycle"
+	"doc-connect/models"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errBookingBlocked is returned when the booking policy doesn't allow a patient to book
+var errBookingBlocked = errors.New("booking blocked after repeated no-shows")
+
+// CheckInAppointment records the arrival of the patient, done by the patient or at the doctor's desk
+func CheckInAppointment(c *gin.Context) {
+	appointment, _, ok := appointmentForCaller(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	// Patients can only check in on the day of the appointment
+	now := time.Now()
+	if appointment.AppointmentDate.Format("2006-01-02") != now.Format("2006-01-02") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Check-in is only possible on the day of the appointment"})
+		return
+	}
+	if appointment.CheckedInAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Patient has already checked in"})
+		return
+	}
+
+	if err := lifecycle.CheckIn(configuration.DB, &appointment, now, actorFromContext(c)); err != nil {
+		transitionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Patient checked in successfully",
+		"data":    appointment,
+	})
+}
+
+// MarkNoShow marks a confirmed appointment whose patient didn't arrive as a no-show
+func MarkNoShow(c *gin.Context) {
+	appointment, _, ok := appointmentForCaller(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	// A patient can only miss a slot that has already started
+	start, err := slotStartTime(appointment.AppointmentDate, appointment.AppointmentTimeSlot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid time slot on appointment"})
+		return
+	}
+	if time.Now().Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointment slot has not started yet"})
+		return
+	}
+
+	if err := lifecycle.Transition(configuration.DB, &appointment, lifecycle.Change{
+		To:     models.BookingNoShow,
+		Actor:  actorFromContext(c),
+		Reason: "patient did not show up",
+	}); err != nil {
+		transitionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Appointment marked as no-show",
+		"data":    appointment,
+	})
+}
+
+// GetNoShowCounts lists the number of no-shows per patient, optionally for a single patient
+func GetNoShowCounts(c *gin.Context) {
+	var counts []struct {
+		PatientID int   `json:"patient_id"`
+		NoShows   int64 `json:"no_shows"`
+	}
+
+	query := configuration.DB.Model(&models.Appointment{}).
+		Select("patient_id, COUNT(*) AS no_shows").
+		Where("booking_status = ?", models.BookingNoShow).
+		Group("patient_id").
+		Order("no_shows DESC")
+	if patientID := c.Query("patient_id"); patientID != "" {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if err := query.Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch no-show counts"})
+		return
+	}
+
+	policy, err := currentBookingPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch booking policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "No-show counts fetched successfully",
+		"data":    counts,
+		"policy":  policy,
+	})
+}
+
+// ViewBookingPolicy shows the booking policy for patients with repeated no-shows
+func ViewBookingPolicy(c *gin.Context) {
+	policy, err := currentBookingPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch booking policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Booking policy fetched successfully",
+		"data":    policy,
+	})
+}
+
+// UpdateBookingPolicy sets after how many no-shows patients have to prepay or can't book anymore
+func UpdateBookingPolicy(c *gin.Context) {
+	var policyRequest struct {
+		NoShowThreshold int    `json:"no_show_threshold" binding:"min=0"`
+		NoShowAction    string `json:"no_show_action"`
+	}
+
+	if err := c.BindJSON(&policyRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if policyRequest.NoShowThreshold > 0 && policyRequest.NoShowAction != models.NoShowActionPrepay && policyRequest.NoShowAction != models.NoShowActionBlock {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No-show action must be prepay or block"})
+		return
+	}
+
+	policy, err := currentBookingPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch booking policy"})
+		return
+	}
+
+	policy.NoShowThreshold = policyRequest.NoShowThreshold
+	policy.NoShowAction = policyRequest.NoShowAction
+	policy.UpdatedBy = actorFromContext(c)
+	if err := configuration.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Booking policy updated successfully",
+		"data":    policy,
+	})
+}
+
+// currentBookingPolicy returns the booking policy, a disabled one if none is configured yet
+func currentBookingPolicy() (models.BookingPolicy, error) {
+	var policy models.BookingPolicy
+	err := configuration.DB.Order("id").First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return policy, nil
+	}
+	return policy, err
+}
+
+// applyNoShowPolicy checks the no-shows of a patient against the booking policy and reports
+// whether the new booking has to be prepaid. It returns errBookingBlocked if the patient can't book.
+func applyNoShowPolicy(patientID int) (bool, error) {
+	policy, err := currentBookingPolicy()
+	if err != nil || policy.NoShowThreshold <= 0 {
+		return false, err
+	}
+
+	var noShows int64
+	if err := configuration.DB.Model(&models.Appointment{}).
+		Where("patient_id = ? AND booking_status = ?", patientID, models.BookingNoShow).
+		Count(&noShows).Error; err != nil {
+		return false, err
+	}
+	if noShows < int64(policy.NoShowThreshold) {
+		return false, nil
+	}
+
+	if policy.NoShowAction == models.NoShowActionBlock {
+		return false, errBookingBlocked
+	}
+	return true, nil
+}
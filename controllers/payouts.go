@@ -0,0 +1,541 @@
+package controllers
+
+import (
+	"bytes"
+	"doc-connect/billing"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"gorm.io/gorm"
+)
+
+// payoutTransitions lists the statuses a payout can move to from each status. Paid is final.
+var payoutTransitions = map[string][]string{
+	models.PayoutPending: {models.PayoutOnHold, models.PayoutPaid},
+	models.PayoutOnHold:  {models.PayoutPending, models.PayoutPaid},
+}
+
+// lastPayoutPeriod returns the start and (exclusive) end of the latest payout period that
+// ended before now
+func lastPayoutPeriod(now time.Time) (time.Time, time.Time) {
+	if configuration.PayoutPeriod() == configuration.PayoutWeekly {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, -7), monday
+	}
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return firstOfMonth.AddDate(0, -1, 0), firstOfMonth
+}
+
+// unsettledInvoices selects the paid, not refunded invoices no payout settled yet
+func unsettledInvoices(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.Invoice{}).
+		Where("invoices.payment_status = ?", models.InvoicePaid).
+		Where("NOT EXISTS (SELECT 1 FROM payout_items WHERE payout_items.invoice_id = invoices.invoice_id)")
+}
+
+// refundedSettlements selects the settled payout items of invoices refunded afterwards that
+// no adjustment took back yet
+func refundedSettlements(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.PayoutItem{}).
+		Joins("JOIN payouts ON payouts.id = payout_items.payout_id").
+		Joins("JOIN invoices ON invoices.invoice_id = payout_items.invoice_id").
+		Where("payout_items.kind = ? AND invoices.payment_status = ? AND invoices.amount_refunded > 0",
+			models.PayoutItemSettlement, models.InvoiceRefunded).
+		Where("NOT EXISTS (SELECT 1 FROM payout_items adjustments WHERE adjustments.invoice_id = payout_items.invoice_id AND adjustments.kind = ?)",
+			models.PayoutItemRefundAdjustment)
+}
+
+// refundedSettlement is a settled payout item of an invoice refunded afterwards
+type refundedSettlement struct {
+	models.PayoutItem
+	TotalAmount    money.Amount
+	AmountRefunded money.Amount
+}
+
+// findRefundedSettlements returns the refunded settlements of a doctor no adjustment took back yet
+func findRefundedSettlements(tx *gorm.DB, doctorID uint, currency string) ([]refundedSettlement, error) {
+	var refunded []refundedSettlement
+	err := refundedSettlements(tx).Select("payout_items.*, invoices.total_amount, invoices.amount_refunded").
+		Where("payouts.doctor_id = ? AND payouts.currency = ?", doctorID, currency).
+		Order("payout_items.invoice_id").Scan(&refunded).Error
+	return refunded, err
+}
+
+// adjustment takes back the share of the settlement that was refunded, at the commission it
+// was settled with. The doctor keeps their share of what the platform kept of a partial refund.
+func (settled refundedSettlement) adjustment() models.PayoutItem {
+	earnings := settled.Earnings.Prorate(settled.AmountRefunded, settled.TotalAmount)
+	commission := settled.Commission.Prorate(settled.AmountRefunded, settled.TotalAmount)
+	return models.PayoutItem{
+		InvoiceID:         settled.InvoiceID,
+		Kind:              models.PayoutItemRefundAdjustment,
+		AppointmentID:     settled.AppointmentID,
+		AppointmentDate:   settled.AppointmentDate,
+		Earnings:          -earnings,
+		CommissionPercent: settled.CommissionPercent,
+		Commission:        -commission,
+		NetAmount:         commission - earnings,
+	}
+}
+
+// GeneratePayoutStatements generates the payout statements of the last ended period. A
+// statement settles every unsettled invoice of the doctor with an appointment before the end
+// of the period, so invoices paid late are settled by the next statement. An invoice refunded
+// after a statement settled it, whether that statement was paid or not, is taken back in
+// proportion to the refund by a negative adjustment on the next statement. It returns the
+// number of statements generated.
+func GeneratePayoutStatements() (int, error) {
+	start, end := lastPayoutPeriod(time.Now())
+
+	type doctorCurrency struct {
+		DoctorID uint
+		Currency string
+	}
+	var owed, adjusted []doctorCurrency
+	if err := unsettledInvoices(configuration.DB).
+		Joins("JOIN appointments ON appointments.appointment_id = invoices.appointment_id").
+		Where("appointments.appointment_date < ?", end).
+		Distinct("invoices.doctor_id", "invoices.currency").
+		Scan(&owed).Error; err != nil {
+		return 0, err
+	}
+	if err := refundedSettlements(configuration.DB).
+		Distinct("payouts.doctor_id", "payouts.currency").
+		Scan(&adjusted).Error; err != nil {
+		return 0, err
+	}
+	for _, doctor := range adjusted {
+		found := false
+		for _, other := range owed {
+			found = found || other == doctor
+		}
+		if !found {
+			owed = append(owed, doctor)
+		}
+	}
+
+	generated := 0
+	var errs []error
+	for _, doctor := range owed {
+		var created bool
+		err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			_, created, err = generatePayout(tx, doctor.DoctorID, doctor.Currency, start, end)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to generate payout of doctor %d: %w", doctor.DoctorID, err))
+			continue
+		}
+		if created {
+			generated++
+		}
+	}
+	return generated, errors.Join(errs...)
+}
+
+// generatePayout creates the payout statement of a doctor for a period, unless there is one
+// already or nothing to settle or adjust. It returns whether a statement was created. The net
+// amount of a statement with adjustments only is negative, what the doctor owes back.
+func generatePayout(tx *gorm.DB, doctorID uint, currency string, start, end time.Time) (models.Payout, bool, error) {
+	payout := models.Payout{
+		DoctorID:    doctorID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Currency:    currency,
+		Status:      models.PayoutPending,
+	}
+
+	var count int64
+	if err := tx.Model(&models.Payout{}).Where("doctor_id = ? AND period_start = ? AND currency = ?", doctorID, start, currency).
+		Count(&count).Error; err != nil || count > 0 {
+		return payout, false, err
+	}
+
+	var doctor models.Doctor
+	if err := tx.First(&doctor, doctorID).Error; err != nil {
+		return payout, false, err
+	}
+	percent, err := commissionPercent(tx, doctor)
+	if err != nil {
+		return payout, false, err
+	}
+
+	var invoices []models.Invoice
+	if err := unsettledInvoices(tx).Preload("Items").
+		Where("invoices.doctor_id = ? AND invoices.currency = ?", doctorID, currency).
+		Where("invoices.appointment_id IN (?)", tx.Model(&models.Appointment{}).Select("appointment_id").Where("appointment_date < ?", end)).
+		Order("invoices.invoice_id").Find(&invoices).Error; err != nil {
+		return payout, false, err
+	}
+	refunded, err := findRefundedSettlements(tx, doctorID, currency)
+	if err != nil {
+		return payout, false, err
+	}
+	if len(invoices) == 0 && len(refunded) == 0 {
+		return payout, false, nil
+	}
+
+	appointmentDates, err := appointmentDatesOf(tx, invoices)
+	if err != nil {
+		return payout, false, err
+	}
+
+	for _, invoice := range invoices {
+		earnings := billing.DoctorEarnings(invoice)
+		commission := earnings.Percent(percent)
+		payout.Items = append(payout.Items, models.PayoutItem{
+			InvoiceID:         invoice.InvoiceID,
+			Kind:              models.PayoutItemSettlement,
+			AppointmentID:     invoice.AppointmentID,
+			AppointmentDate:   appointmentDates[invoice.AppointmentID],
+			Earnings:          earnings,
+			CommissionPercent: percent,
+			Commission:        commission,
+			NetAmount:         earnings - commission,
+		})
+	}
+
+	for _, settled := range refunded {
+		payout.Items = append(payout.Items, settled.adjustment())
+	}
+
+	for _, item := range payout.Items {
+		payout.Earnings += item.Earnings
+		payout.Commission += item.Commission
+		payout.NetAmount += item.NetAmount
+	}
+
+	// The unique invoice index keeps an invoice from being settled or adjusted twice
+	if err := tx.Create(&payout).Error; err != nil {
+		return payout, false, err
+	}
+	return payout, true, nil
+}
+
+// appointmentDatesOf returns the appointment dates of invoices by appointment id
+func appointmentDatesOf(tx *gorm.DB, invoices []models.Invoice) (map[uint]time.Time, error) {
+	ids := make([]uint, 0, len(invoices))
+	for _, invoice := range invoices {
+		ids = append(ids, invoice.AppointmentID)
+	}
+
+	var appointments []models.Appointment
+	if err := tx.Where("appointment_id IN ?", ids).Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+	dates := make(map[uint]time.Time, len(appointments))
+	for _, appointment := range appointments {
+		dates[uint(appointment.AppointmentID)] = appointment.AppointmentDate
+	}
+	return dates, nil
+}
+
+// GeneratePayouts generates the payout statements of the last ended period right away
+func GeneratePayouts(c *gin.Context) {
+	generated, err := GeneratePayoutStatements()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "generated": generated})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": fmt.Sprintf("%d payout statements generated", generated),
+	})
+}
+
+// ViewPayouts lists payouts, optionally filtered by status or doctor
+func ViewPayouts(c *gin.Context) {
+	query := configuration.DB.Order("period_start DESC, id DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if doctorID := c.Query("doctor_id"); doctorID != "" {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+
+	var payouts []models.Payout
+	if err := query.Find(&payouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Payouts fetched successfully",
+		"data":    payouts,
+	})
+}
+
+// UpdatePayoutStatus puts a payout on hold, releases it, or records its transfer to the doctor
+func UpdatePayoutStatus(c *gin.Context) {
+	var payoutRequest struct {
+		Status    string `json:"status" binding:"required"`
+		Reference string `json:"reference"`
+	}
+	if err := c.BindJSON(&payoutRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var payout models.Payout
+	if err := configuration.DB.First(&payout, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout not found"})
+		return
+	}
+
+	allowed := false
+	for _, status := range payoutTransitions[payout.Status] {
+		allowed = allowed || status == payoutRequest.Status
+	}
+	if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Payout can't move from %s to %s", payout.Status, payoutRequest.Status)})
+		return
+	}
+
+	updates := map[string]interface{}{"status": payoutRequest.Status}
+	if payoutRequest.Status == models.PayoutPaid {
+		if payoutRequest.Reference == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reference of the transfer is required"})
+			return
+		}
+		updates["reference"] = payoutRequest.Reference
+		updates["paid_at"] = time.Now()
+	}
+
+	result := configuration.DB.Model(&models.Payout{}).Where("id = ? AND status = ?", payout.ID, payout.Status).Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payout"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payout was changed meanwhile, please retry"})
+		return
+	}
+	configuration.DB.First(&payout, payout.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Payout updated successfully",
+		"data":    payout,
+	})
+}
+
+// ViewEarnings shows the authenticated doctor what is not settled yet and the totals of
+// their payouts by status
+func ViewEarnings(c *gin.Context) {
+	doctorID, _ := c.Get("doctor_id")
+	var doctor models.Doctor
+	if err := configuration.DB.First(&doctor, doctorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+		return
+	}
+	percent, err := commissionPercent(configuration.DB, doctor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commission"})
+		return
+	}
+
+	// Unsettled invoices are estimated with the current commission
+	var invoices []models.Invoice
+	if err := unsettledInvoices(configuration.DB).Preload("Items").
+		Where("invoices.doctor_id = ? AND invoices.currency = ?", doctor.DoctorID, money.INR).
+		Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
+		return
+	}
+	var earnings money.Amount
+	for _, invoice := range invoices {
+		earnings += billing.DoctorEarnings(invoice)
+	}
+	commission := earnings.Percent(percent)
+
+	// Refunded invoices the next statement takes back
+	refunded, err := findRefundedSettlements(configuration.DB, doctor.DoctorID, money.INR)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunded invoices"})
+		return
+	}
+	for _, settled := range refunded {
+		adjustment := settled.adjustment()
+		earnings += adjustment.Earnings
+		commission += adjustment.Commission
+	}
+
+	var totals []struct {
+		Status    string
+		NetAmount money.Amount
+	}
+	if err := configuration.DB.Model(&models.Payout{}).
+		Select("status, SUM(net_amount) AS net_amount").
+		Where("doctor_id = ? AND currency = ?", doctor.DoctorID, money.INR).
+		Group("status").Scan(&totals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payouts"})
+		return
+	}
+	payouts := map[string]money.Amount{models.PayoutPending: 0, models.PayoutOnHold: 0, models.PayoutPaid: 0}
+	for _, total := range totals {
+		payouts[total.Status] = total.NetAmount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Earnings fetched successfully",
+		"data": gin.H{
+			"currency":           money.INR,
+			"commission_percent": percent,
+			"unsettled": gin.H{
+				"invoices":    len(invoices),
+				"adjustments": len(refunded),
+				"earnings":    earnings,
+				"commission":  commission,
+				"net_amount":  earnings - commission,
+			},
+			"payouts": payouts,
+		},
+	})
+}
+
+// ViewDoctorPayouts lists the payout statements of the authenticated doctor
+func ViewDoctorPayouts(c *gin.Context) {
+	doctorID, _ := c.Get("doctor_id")
+	var payouts []models.Payout
+	if err := configuration.DB.Where("doctor_id = ?", doctorID).Order("period_start DESC, id DESC").Find(&payouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Payouts fetched successfully",
+		"data":    payouts,
+	})
+}
+
+// PayoutStatement exports a payout statement of the authenticated doctor as PDF, or as CSV
+// with ?format=csv
+func PayoutStatement(c *gin.Context) {
+	doctorID, _ := c.Get("doctor_id")
+	var payout models.Payout
+	if err := configuration.DB.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("appointment_date, invoice_id") }).
+		Where("id = ? AND doctor_id = ?", c.Param("id"), doctorID).First(&payout).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout not found"})
+		return
+	}
+
+	filename := fmt.Sprintf("payout-%d-%s", payout.ID, payout.PeriodStart.Format("20060102"))
+	switch c.DefaultQuery("format", "pdf") {
+	case "csv":
+		statement, err := payoutCSV(payout)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate payout statement"})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+		c.Data(http.StatusOK, "text/csv", statement)
+	case "pdf":
+		var doctor models.Doctor
+		if err := configuration.DB.First(&doctor, payout.DoctorID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch doctor details"})
+			return
+		}
+		statement, err := payoutPDF(payout, doctor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate payout statement"})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+filename+".pdf")
+		c.Data(http.StatusOK, "application/pdf", statement)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or csv"})
+	}
+}
+
+// payoutCSV writes the settled invoices of a payout as CSV
+func payoutCSV(payout models.Payout) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write([]string{"invoice_id", "appointment_id", "appointment_date", "earnings", "commission_percent", "commission", "net_amount", "currency", "kind"})
+	for _, item := range payout.Items {
+		writer.Write([]string{
+			fmt.Sprint(item.InvoiceID),
+			fmt.Sprint(item.AppointmentID),
+			item.AppointmentDate.Format("2006-01-02"),
+			item.Earnings.String(),
+			fmt.Sprint(item.CommissionPercent),
+			item.Commission.String(),
+			item.NetAmount.String(),
+			payout.Currency,
+			item.Kind,
+		})
+	}
+	writer.Write([]string{"total", "", "", payout.Earnings.String(), "", payout.Commission.String(), payout.NetAmount.String(), payout.Currency, ""})
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// payoutPDF renders a payout statement as PDF
+func payoutPDF(payout models.Payout, doctor models.Doctor) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.AddPage()
+
+	pdf.SetFont("Arial", "B", 14)
+	pdf.SetTextColor(128, 0, 128) // Dark purple color
+	pdf.CellFormat(0, 10, "Go - Doctor Appointment Booking", "", 1, "C", false, 0, "")
+
+	pdf.SetFont("Arial", "B", 12)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.CellFormat(0, 10, "Payout Statement", "1", 1, "C", false, 0, "")
+	add2Detail(pdf, "Statement ID", fmt.Sprintf("%d", payout.ID), true)
+	add2Detail(pdf, "Doctor Name", doctor.Name, true)
+	add2Detail(pdf, "Period", payout.PeriodStart.Format("2006-01-02")+" to "+payout.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02"), true)
+	add2Detail(pdf, "Status", payout.Status, true)
+	if payout.Reference != "" {
+		add2Detail(pdf, "Transfer Reference", payout.Reference, true)
+	}
+
+	pdf.SetFont("Arial", "B", 10)
+	pdf.CellFormat(25, 8, "Invoice", "1", 0, "", false, 0, "")
+	pdf.CellFormat(35, 8, "Appointment date", "1", 0, "", false, 0, "")
+	pdf.CellFormat(35, 8, "Earnings", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(40, 8, "Commission", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 8, "Net", "1", 1, "R", false, 0, "")
+
+	pdf.SetFont("Arial", "", 10)
+	for _, item := range payout.Items {
+		invoice := fmt.Sprintf("%d", item.InvoiceID)
+		if item.Kind == models.PayoutItemRefundAdjustment {
+			invoice += " refund"
+		}
+		pdf.CellFormat(25, 8, invoice, "1", 0, "", false, 0, "")
+		pdf.CellFormat(35, 8, item.AppointmentDate.Format("2006-01-02"), "1", 0, "", false, 0, "")
+		pdf.CellFormat(35, 8, item.Earnings.String(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(40, 8, fmt.Sprintf("%s (%g%%)", item.Commission, item.CommissionPercent), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(0, 8, item.NetAmount.String(), "1", 1, "R", false, 0, "")
+	}
+
+	add2Detail(pdf, "Earnings", money.New(payout.Earnings, payout.Currency).String(), false)
+	add2Detail(pdf, "Commission", money.New(-payout.Commission, payout.Currency).String(), false)
+	pdf.SetFont("Arial", "B", 13)
+	add2Detail(pdf, "Net Payout", money.New(payout.NetAmount, payout.Currency).String(), true)
+
+	pdf.SetY(pdf.GetY() + 12)
+	pdf.CellFormat(0, 10, "This is a computer generated statement", "", 1, "R", false, 0, "")
+
+	var pdfBuffer bytes.Buffer
+	if err := pdf.Output(&pdfBuffer); err != nil {
+		return nil, err
+	}
+	return pdfBuffer.Bytes(), nil
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"doc-connect/models"
+	"doc-connect/money"
+	"testing"
+)
+
+func TestRefundAdjustment(t *testing.T) {
+	settled := models.PayoutItem{
+		InvoiceID:         7,
+		Kind:              models.PayoutItemSettlement,
+		Earnings:          50000,
+		CommissionPercent: 10,
+		Commission:        5000,
+		NetAmount:         45000,
+	}
+
+	tests := []struct {
+		name           string
+		refunded       money.Amount
+		wantEarnings   money.Amount
+		wantCommission money.Amount
+	}{
+		{"full refund", 59000, -50000, -5000},
+		{"half refunded", 29500, -25000, -2500},
+		{"a third refunded", 19667, -16667, -1667},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adjustment := refundedSettlement{PayoutItem: settled, TotalAmount: 59000, AmountRefunded: tt.refunded}.adjustment()
+			if adjustment.Kind != models.PayoutItemRefundAdjustment || adjustment.InvoiceID != settled.InvoiceID {
+				t.Errorf("adjustment is a %s of invoice %d, want a %s of invoice %d",
+					adjustment.Kind, adjustment.InvoiceID, models.PayoutItemRefundAdjustment, settled.InvoiceID)
+			}
+			if adjustment.Earnings != tt.wantEarnings || adjustment.Commission != tt.wantCommission ||
+				adjustment.NetAmount != tt.wantEarnings-tt.wantCommission {
+				t.Errorf("adjustment takes back %v earnings, %v commission, %v net, want %v, %v, %v",
+					adjustment.Earnings, adjustment.Commission, adjustment.NetAmount,
+					tt.wantEarnings, tt.wantCommission, tt.wantEarnings-tt.wantCommission)
+			}
+		})
+	}
+}
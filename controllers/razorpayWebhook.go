@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"doc-connect/payments"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// razorpayProvider is the name Razorpay payment attempts and refunds are stored with
+const razorpayProvider = "razorpay"
+
+// razorpayWebhook is the part of a Razorpay webhook body the server uses
+type razorpayWebhook struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity struct {
+				ID               string `json:"id"`
+				OrderID          string `json:"order_id"`
+				Amount           int64  `json:"amount"`
+				Currency         string `json:"currency"`
+				ErrorDescription string `json:"error_description"`
+			} `json:"entity"`
+		} `json:"payment"`
+		Refund struct {
+			Entity struct {
+				ID        string `json:"id"`
+				PaymentID string `json:"payment_id"`
+			} `json:"entity"`
+		} `json:"refund"`
+	} `json:"payload"`
+}
+
+// RazorpayWebhook receives payment and refund events from Razorpay. Each event is processed
+// once; redeliveries of an event that was already processed are acknowledged without effect.
+func RazorpayWebhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	if !payments.VerifyRazorpayWebhook(body, c.GetHeader("X-Razorpay-Signature"), configuration.RazorpayWebhookSecret()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+
+	var webhook razorpayWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
+	}
+
+	// Razorpay sends the same event id on every delivery of an event
+	eventID := c.GetHeader("X-Razorpay-Event-Id")
+	if eventID == "" {
+		sum := sha256.Sum256(body)
+		eventID = hex.EncodeToString(sum[:])
+	}
+
+	var paidInvoice *models.Invoice
+	event := models.WebhookEvent{EventID: eventID, Event: webhook.Event, Status: models.WebhookProcessed}
+	err = configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		var note string
+		var err error
+		switch webhook.Event {
+		case "payment.captured":
+			paidInvoice, note, err = handlePaymentCaptured(tx, webhook)
+		case "payment.failed":
+			note, err = handlePaymentFailed(tx, webhook)
+		case "refund.processed":
+			note, err = handleRefundProcessed(tx, webhook)
+		default:
+			note = "event not handled"
+		}
+		if err != nil {
+			return err
+		}
+
+		if note != "" {
+			event.Status = models.WebhookIgnored
+			event.Note = note
+			return tx.Model(&event).Updates(map[string]interface{}{"status": event.Status, "note": event.Note}).Error
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusOK, gin.H{"Status": "Success", "Message": "Event already processed"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to process Razorpay event %s (%s): %v\n", eventID, webhook.Event, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process event"})
+		return
+	}
+
+	// Let the patient know, in case checkout didn't return to the success page
+	if paidInvoice != nil {
+		if err := sendPaymentConfirmation(*paidInvoice); err != nil {
+			log.Println("Failed to send payment confirmation email:", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Status": "Success", "Message": "Event processed", "data": event})
+}
+
+// handlePaymentCaptured marks the invoice of a captured order as paid and confirms its booking.
+// A payment that can't settle the invoice, e.g. captured after the payment window or for an
+// invoice already paid otherwise, is refunded. It returns a note when the event had no effect.
+func handlePaymentCaptured(tx *gorm.DB, webhook razorpayWebhook) (*models.Invoice, string, error) {
+	payment := webhook.Payload.Payment.Entity
+
+	var attempt models.PaymentAttempt
+	if err := tx.Where("provider = ? AND provider_order_id = ?", razorpayProvider, payment.OrderID).First(&attempt).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		note, err := handleTopUpCaptured(tx, webhook)
+		return nil, note, err
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	captured, err := applyCapturedPayment(tx, attempt, payment.ID, money.New(money.Amount(payment.Amount), payment.Currency))
+	if err != nil {
+		return nil, "", err
+	}
+	if captured.Paid {
+		return &captured.Invoice, "", nil
+	}
+	if captured.Refund != nil {
+		return nil, fmt.Sprintf("%s, refund %d queued", captured.Reason, captured.Refund.ID), nil
+	}
+	return nil, captured.Reason, nil
+}
+
+// handleTopUpCaptured credits the wallet of a captured top-up order. It returns a note when
+// the event had no effect.
+func handleTopUpCaptured(tx *gorm.DB, webhook razorpayWebhook) (string, error) {
+	payment := webhook.Payload.Payment.Entity
+
+	topUp, ok, err := topUpOfOrder(tx, razorpayProvider, payment.OrderID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "unknown order " + payment.OrderID, nil
+	}
+
+	paid, err := creditWalletTopUp(tx, topUp, payment.ID)
+	if err != nil {
+		return "", err
+	}
+	if paid.Refund != nil {
+		return fmt.Sprintf("%s, refund %d queued", paid.Reason, paid.Refund.ID), nil
+	}
+	if !paid.Credited {
+		return fmt.Sprintf("wallet top-up %d already credited", topUp.ID), nil
+	}
+	return "", nil
+}
+
+// handlePaymentFailed records a failed payment of an order. The invoice stays pending so the
+// patient can try again.
+func handlePaymentFailed(tx *gorm.DB, webhook razorpayWebhook) (string, error) {
+	payment := webhook.Payload.Payment.Entity
+
+	result := tx.Model(&models.PaymentAttempt{}).
+		Where("provider = ? AND provider_order_id = ? AND status <> ?", razorpayProvider, payment.OrderID, models.PaymentAttemptCaptured).
+		Updates(map[string]interface{}{"provider_payment_id": payment.ID, "status": models.PaymentAttemptFailed})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		// The order may be a wallet top-up
+		result = tx.Model(&models.WalletTopUp{}).
+			Where("provider = ? AND provider_order_id = ? AND status NOT IN ?", razorpayProvider, payment.OrderID,
+				[]string{models.WalletTopUpCredited, models.WalletTopUpRefunded}).
+			Updates(map[string]interface{}{"provider_payment_id": payment.ID, "status": models.WalletTopUpFailed})
+		if result.Error != nil {
+			return "", result.Error
+		}
+	}
+	if result.RowsAffected == 0 {
+		return "unknown or captured order " + payment.OrderID, nil
+	}
+
+	// The wallet part of a split payment is given back, the invoice can be paid again in full
+	var invoice models.Invoice
+	err := tx.Where("invoice_id = (?) AND payment_status = ?",
+		tx.Model(&models.PaymentAttempt{}).Select("invoice_id").Where("provider = ? AND provider_order_id = ?", razorpayProvider, payment.OrderID),
+		models.InvoicePartiallyPaid).First(&invoice).Error
+	if err == nil {
+		if err := reverseWalletPayments(tx, &invoice); err != nil {
+			return "", err
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if payment.ErrorDescription != "" {
+		log.Printf("Razorpay payment %s of order %s failed: %s\n", payment.ID, payment.OrderID, payment.ErrorDescription)
+	}
+	return "", nil
+}
+
+// handleRefundProcessed marks a gateway refund as processed
+func handleRefundProcessed(tx *gorm.DB, webhook razorpayWebhook) (string, error) {
+	gatewayRefund := webhook.Payload.Refund.Entity
+
+	result := tx.Model(&models.Refund{}).
+		Where("provider = ? AND gateway_refund_id = ?", razorpayProvider, gatewayRefund.ID).
+		Update("status", models.RefundProcessed)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "unknown refund " + gatewayRefund.ID, nil
+	}
+	return "", nil
+}
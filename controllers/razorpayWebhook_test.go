@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postWebhook delivers a Razorpay webhook signed with signingSecret
+func postWebhook(t *testing.T, eventID string, payload map[string]interface{}, signingSecret string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write(body)
+
+	router := gin.New()
+	router.POST("/razorpay/webhook", RazorpayWebhook)
+	req := httptest.NewRequest(http.MethodPost, "/razorpay/webhook", strings.NewReader(string(body)))
+	req.Header.Set("X-Razorpay-Signature", hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-Razorpay-Event-Id", eventID)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func paymentEvent(event, orderID, paymentID string, amount money.Amount) map[string]interface{} {
+	return map[string]interface{}{
+		"event": event,
+		"payload": map[string]interface{}{
+			"payment": map[string]interface{}{
+				"entity": map[string]interface{}{
+					"id":       paymentID,
+					"order_id": orderID,
+					"amount":   int64(amount),
+					"currency": money.INR,
+				},
+			},
+		},
+	}
+}
+
+func countRows(t *testing.T, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+	var count int64
+	if err := configuration.DB.Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// createInvoiceOrder creates an order for the outstanding amount of an invoice, like checkout does
+func createInvoiceOrder(t *testing.T, invoice models.Invoice) string {
+	t.Helper()
+	order, err := configuration.PaymentProvider.CreateOrder(invoice.Outstanding(), "invoice")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if err := configuration.DB.Create(&models.PaymentAttempt{
+		InvoiceID:       invoice.InvoiceID,
+		Provider:        razorpayProvider,
+		ProviderOrderID: order.ID,
+		Amount:          invoice.TotalAmount,
+		Currency:        invoice.Currency,
+		Status:          models.PaymentAttemptCreated,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order.ID
+}
+
+func TestRazorpayWebhookRejectsInvalidSignature(t *testing.T) {
+	useFakeRazorpay(t)
+
+	w := postWebhook(t, "evt_forged", paymentEvent("payment.captured", "order_1", "pay_1", 50000), "not-the-webhook-secret")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("forged webhook answered %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
+
+func TestRazorpayWebhookPaymentCapturedOnce(t *testing.T) {
+	useTestDB(t)
+	fake := useFakeRazorpay(t)
+
+	appointment, invoice := createPendingBooking(t, 1, 1, 50000)
+	orderID := createInvoiceOrder(t, invoice)
+	payment, _ := fake.PayOrder(orderID)
+	event := paymentEvent("payment.captured", orderID, payment["id"].(string), invoice.TotalAmount)
+
+	// Razorpay delivers the same event again when it doesn't see the first answer
+	for delivery := 1; delivery <= 2; delivery++ {
+		if w := postWebhook(t, "evt_captured", event, testWebhookSecret); w.Code != http.StatusOK {
+			t.Fatalf("delivery %d answered %d: %s", delivery, w.Code, w.Body)
+		}
+	}
+
+	if err := configuration.DB.First(&invoice, invoice.InvoiceID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if invoice.PaymentStatus != models.InvoicePaid || invoice.AmountPaid != invoice.TotalAmount {
+		t.Errorf("invoice is %s with %v paid, want it paid in full", invoice.PaymentStatus, invoice.AmountPaid)
+	}
+	if err := configuration.DB.First(&appointment, appointment.AppointmentID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if appointment.BookingStatus != models.BookingConfirmed {
+		t.Errorf("booking is %s, want %s", appointment.BookingStatus, models.BookingConfirmed)
+	}
+	if n := countRows(t, &models.WebhookEvent{}, "event_id = ?", "evt_captured"); n != 1 {
+		t.Errorf("%d webhook events recorded, want 1", n)
+	}
+	if n := countRows(t, &models.InvoicePayment{}, "invoice_id = ?", invoice.InvoiceID); n != 1 {
+		t.Errorf("%d invoice payments recorded, want 1", n)
+	}
+	if n := countRows(t, &models.AppointmentTransition{}, "appointment_id = ?", appointment.AppointmentID); n != 1 {
+		t.Errorf("%d appointment transitions recorded, want 1", n)
+	}
+}
+
+func TestRazorpayWebhookPaymentCapturedOnExpiredInvoice(t *testing.T) {
+	useTestDB(t)
+	fake := useFakeRazorpay(t)
+
+	// The expiry job ran while the patient was in checkout
+	appointment, invoice := createPendingBooking(t, 1, 1, 50000)
+	orderID := createInvoiceOrder(t, invoice)
+	expired, err := expireBooking(configuration.DB, &appointment)
+	if err != nil || !expired {
+		t.Fatalf("expireBooking = %v, %v, want the booking expired", expired, err)
+	}
+	payment, _ := fake.PayOrder(orderID)
+	paymentID := payment["id"].(string)
+	event := paymentEvent("payment.captured", orderID, paymentID, invoice.TotalAmount)
+
+	for _, eventID := range []string{"evt_late", "evt_late_again"} {
+		if w := postWebhook(t, eventID, event, testWebhookSecret); w.Code != http.StatusOK {
+			t.Fatalf("event %s answered %d: %s", eventID, w.Code, w.Body)
+		}
+	}
+
+	var refunds []models.Refund
+	if err := configuration.DB.Where("provider_payment_id = ?", paymentID).Find(&refunds).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(refunds) != 1 || refunds[0].Amount != invoice.TotalAmount || refunds[0].Destination != models.RefundToSource {
+		t.Fatalf("refunds of the payment = %+v, want one refund of %v to source", refunds, invoice.TotalAmount)
+	}
+	if err := configuration.DB.First(&invoice, invoice.InvoiceID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if invoice.PaymentStatus != models.InvoiceExpired || invoice.AmountPaid != 0 {
+		t.Errorf("invoice is %s with %v paid, want it still expired and unpaid", invoice.PaymentStatus, invoice.AmountPaid)
+	}
+	if n := countRows(t, &models.InvoicePayment{}, "invoice_id = ?", invoice.InvoiceID); n != 0 {
+		t.Errorf("%d invoice payments recorded, want none", n)
+	}
+}
+
+func TestRazorpayWebhookRefundProcessedOnce(t *testing.T) {
+	useTestDB(t)
+	useFakeRazorpay(t)
+
+	refund := models.Refund{
+		InvoiceID:         1,
+		Provider:          razorpayProvider,
+		ProviderPaymentID: "pay_1",
+		Amount:            50000,
+		Currency:          money.INR,
+		Destination:       models.RefundToSource,
+		Status:            models.RefundPending,
+		GatewayRefundID:   "rfnd_1",
+	}
+	if err := configuration.DB.Create(&refund).Error; err != nil {
+		t.Fatal(err)
+	}
+	event := map[string]interface{}{
+		"event": "refund.processed",
+		"payload": map[string]interface{}{
+			"refund": map[string]interface{}{
+				"entity": map[string]interface{}{"id": "rfnd_1", "payment_id": "pay_1"},
+			},
+		},
+	}
+
+	if w := postWebhook(t, "evt_refund", event, testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("first delivery answered %d: %s", w.Code, w.Body)
+	}
+
+	// A redelivery must not touch the refund, even when it changed since
+	if err := configuration.DB.Model(&refund).Update("status", models.RefundFailed).Error; err != nil {
+		t.Fatal(err)
+	}
+	w := postWebhook(t, "evt_refund", event, testWebhookSecret)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "already processed") {
+		t.Fatalf("redelivery answered %d: %s, want the event acknowledged as already processed", w.Code, w.Body)
+	}
+	if err := configuration.DB.First(&refund, refund.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if refund.Status != models.RefundFailed {
+		t.Errorf("redelivery changed the refund to %s", refund.Status)
+	}
+	if n := countRows(t, &models.WebhookEvent{}, "event_id = ?", "evt_refund"); n != 1 {
+		t.Errorf("%d webhook events recorded, want 1", n)
+	}
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddRefundRule adds a tier to the cancellation refund policy
+func AddRefundRule(c *gin.Context) {
+	rule := models.RefundRule{Active: true}
+	if err := c.BindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = 0
+
+	if err := validateRefundRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := configuration.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add refund rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Refund rule added successfully",
+		"data":    rule,
+	})
+}
+
+// ViewRefundRules lists the refund rules in the order they are evaluated
+func ViewRefundRules(c *gin.Context) {
+	var rules []models.RefundRule
+	if err := configuration.DB.Order("priority, id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refund rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Refund rules fetched successfully",
+		"data":    rules,
+	})
+}
+
+// UpdateRefundRule updates a refund rule, e.g. to change its refund or deactivate it
+func UpdateRefundRule(c *gin.Context) {
+	var rule models.RefundRule
+	if err := configuration.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund rule not found"})
+		return
+	}
+
+	id := rule.ID
+	if err := c.BindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = id
+
+	if err := validateRefundRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := configuration.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update refund rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Refund rule updated successfully",
+		"data":    rule,
+	})
+}
+
+// RemoveRefundRule deletes a refund rule
+func RemoveRefundRule(c *gin.Context) {
+	result := configuration.DB.Delete(&models.RefundRule{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove refund rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Refund rule removed successfully",
+	})
+}
+
+// validateRefundRule checks the values of a refund rule sent by an admin
+func validateRefundRule(rule models.RefundRule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+
+	switch rule.CancelledBy {
+	case models.RefundRuleAnyCanceller, "patient", "doctor":
+	default:
+		return errors.New("cancelled_by must be patient, doctor or any")
+	}
+
+	switch rule.PaymentMethod {
+	case models.RefundRuleAnyMethod, "online", "wallet", "Offline", models.PaymentMethodSplit:
+	default:
+		return errors.New("payment_method must be online, wallet, Offline, split or any")
+	}
+
+	if rule.MinHoursBefore < 0 {
+		return errors.New("min_hours_before cannot be negative")
+	}
+	if rule.RefundPercent < 0 || rule.RefundPercent > 100 {
+		return errors.New("refund_percent must be between 0 and 100")
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/ledger"
+	"doc-connect/models"
+	"doc-connect/money"
+	"doc-connect/payments"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxRefundAttempts is how often a gateway refund is tried before it is marked as failed
+const maxRefundAttempts = 5
+
+// capturedPayment returns the payment attempt an invoice was paid with online
+func capturedPayment(invoiceID uint) (models.PaymentAttempt, error) {
+	var attempt models.PaymentAttempt
+	err := configuration.DB.Where("invoice_id = ? AND status = ? AND provider_payment_id <> ''", invoiceID, models.PaymentAttemptCaptured).
+		Order("id").First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return attempt, errors.New("no gateway payment found for the invoice")
+	}
+	return attempt, err
+}
+
+// queueSourceRefund records a pending refund of a whole payment that can't be applied to its
+// invoice. A payment is refunded once, even if checkout and the webhook both report it.
+func queueSourceRefund(tx *gorm.DB, invoiceID uint, provider, paymentID string, amount money.Money) (models.Refund, error) {
+	refund := models.Refund{
+		InvoiceID:         invoiceID,
+		Provider:          provider,
+		ProviderPaymentID: paymentID,
+		Amount:            amount.Amount,
+		Currency:          amount.Currency,
+		Destination:       models.RefundToSource,
+		Status:            models.RefundPending,
+	}
+	err := tx.Where("provider = ? AND provider_payment_id = ?", provider, paymentID).FirstOrCreate(&refund).Error
+	return refund, err
+}
+
+// refundProvider returns the payment provider a refund has to be issued with
+func refundProvider(refund *models.Refund) (payments.Provider, error) {
+	provider := configuration.PaymentProvider
+	if refund.Provider != "" && refund.Provider != provider.Name() {
+		return nil, fmt.Errorf("refund was paid through %s, but %s is configured", refund.Provider, provider.Name())
+	}
+	return provider, nil
+}
+
+// creditWalletRefund records a refund to the patient's wallet and credits the wallet
+func creditWalletRefund(tx *gorm.DB, invoice models.Invoice, amount money.Amount) (models.Refund, error) {
+	refund := models.Refund{
+		InvoiceID:   invoice.InvoiceID,
+		Amount:      amount,
+		Currency:    invoice.Currency,
+		Destination: models.RefundToWallet,
+		Status:      models.RefundProcessed,
+	}
+
+	// Only a wallet of the invoice currency can be credited
+	if _, err := ledger.Credit(tx, ledger.Entry{
+		UserID:         int(invoice.PatientID),
+		Amount:         money.New(amount, invoice.Currency),
+		Reason:         models.WalletReasonRefund,
+		Description:    fmt.Sprintf("Refund of invoice %d", invoice.InvoiceID),
+		InvoiceID:      invoice.InvoiceID,
+		AppointmentID:  int(invoice.AppointmentID),
+		IdempotencyKey: fmt.Sprintf("refund:invoice:%d", invoice.InvoiceID),
+	}); err != nil {
+		return refund, err
+	}
+	return refund, tx.Create(&refund).Error
+}
+
+// issueGatewayRefund asks the payment provider to refund a pending refund to the original payment.
+// Failed calls leave the refund pending so the reconcile job retries it.
+func issueGatewayRefund(refund *models.Refund) error {
+	refund.Attempts++
+	provider, err := refundProvider(refund)
+	var gatewayRefund payments.Refund
+	if err == nil {
+		notes := map[string]string{"invoice_id": fmt.Sprint(refund.InvoiceID)}
+		if refund.WalletTopUpID != 0 {
+			notes = map[string]string{"wallet_top_up_id": fmt.Sprint(refund.WalletTopUpID)}
+		}
+		gatewayRefund, err = provider.Refund(refund.ProviderPaymentID, money.New(refund.Amount, refund.Currency), notes)
+	}
+	if err != nil {
+		refund.FailureReason = err.Error()
+		if refund.Attempts >= maxRefundAttempts {
+			refund.Status = models.RefundFailed
+		}
+	} else {
+		refund.GatewayRefundID = gatewayRefund.ID
+		refund.Status = gatewayRefundStatus(gatewayRefund)
+		refund.FailureReason = ""
+	}
+
+	if saveErr := configuration.DB.Save(refund).Error; saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// gatewayRefundStatus maps the status of a provider refund to the status of a refund
+func gatewayRefundStatus(gatewayRefund payments.Refund) string {
+	switch gatewayRefund.Status {
+	case payments.RefundProcessed:
+		return models.RefundProcessed
+	case payments.RefundFailed:
+		return models.RefundFailed
+	default:
+		return models.RefundPending
+	}
+}
+
+// ReconcileRefunds retries gateway refunds that couldn't be issued and fetches the status of
+// the ones the payment provider is still processing. It returns the number of refunds that changed.
+func ReconcileRefunds() (int, error) {
+	var refunds []models.Refund
+	if err := configuration.DB.Where("destination = ? AND status = ?", models.RefundToSource, models.RefundPending).Find(&refunds).Error; err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var errs []error
+	for i := range refunds {
+		refund := &refunds[i]
+		previous := *refund
+
+		if refund.GatewayRefundID == "" {
+			if err := issueGatewayRefund(refund); err != nil {
+				errs = append(errs, fmt.Errorf("failed to issue refund %d: %w", refund.ID, err))
+			}
+		} else {
+			provider, err := refundProvider(refund)
+			var gatewayRefund payments.Refund
+			if err == nil {
+				gatewayRefund, err = provider.FetchRefund(refund.GatewayRefundID)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to fetch refund %d: %w", refund.ID, err))
+				continue
+			}
+			refund.Status = gatewayRefundStatus(gatewayRefund)
+			if refund.Status != previous.Status {
+				if err := configuration.DB.Model(refund).Update("status", refund.Status).Error; err != nil {
+					errs = append(errs, fmt.Errorf("failed to update refund %d: %w", refund.ID, err))
+					continue
+				}
+			}
+		}
+
+		if refund.Status != previous.Status || refund.GatewayRefundID != previous.GatewayRefundID {
+			changed++
+		}
+		if refund.Status == models.RefundFailed {
+			log.Printf("Refund %d of invoice %d failed at the gateway: %s\n", refund.ID, refund.InvoiceID, refund.FailureReason)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// ViewRefunds lists refunds, optionally filtered by status or invoice
+func ViewRefunds(c *gin.Context) {
+	query := configuration.DB.Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if invoiceID := c.Query("invoice_id"); invoiceID != "" {
+		query = query.Where("invoice_id = ?", invoiceID)
+	}
+
+	var refunds []models.Refund
+	if err := query.Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Refunds fetched successfully",
+		"data":    refunds,
+	})
+}
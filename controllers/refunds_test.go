@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"doc-connect/razorpayfake"
+	"testing"
+)
+
+// capturedRazorpayPayment pays an order of amount at the fake Razorpay API and returns the payment id
+func capturedRazorpayPayment(t *testing.T, fake *razorpayfake.Server, amount money.Amount) string {
+	t.Helper()
+	order, err := configuration.PaymentProvider.CreateOrder(money.New(amount, money.INR), "invoice")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	payment, _ := fake.PayOrder(order.ID)
+	return payment["id"].(string)
+}
+
+func sourceRefund(t *testing.T, paymentID string, amount money.Amount) models.Refund {
+	t.Helper()
+	refund := models.Refund{
+		InvoiceID:         1,
+		Provider:          razorpayProvider,
+		ProviderPaymentID: paymentID,
+		Amount:            amount,
+		Currency:          money.INR,
+		Destination:       models.RefundToSource,
+		Status:            models.RefundPending,
+	}
+	if err := configuration.DB.Create(&refund).Error; err != nil {
+		t.Fatal(err)
+	}
+	return refund
+}
+
+func TestIssueGatewayRefund(t *testing.T) {
+	useTestDB(t)
+	fake := useFakeRazorpay(t)
+
+	tests := []struct {
+		name          string
+		gatewayStatus string
+		want          string
+	}{
+		{"processed right away", "processed", models.RefundProcessed},
+		{"processed later", "pending", models.RefundPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.RefundStatus = tt.gatewayStatus
+			refund := sourceRefund(t, capturedRazorpayPayment(t, fake, 50000), 50000)
+
+			if err := issueGatewayRefund(&refund); err != nil {
+				t.Fatalf("issueGatewayRefund: %v", err)
+			}
+			var stored models.Refund
+			if err := configuration.DB.First(&stored, refund.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.want || stored.GatewayRefundID == "" || stored.Attempts != 1 {
+				t.Errorf("refund is %s with gateway id %q after %d attempts, want %s with a gateway id after 1",
+					stored.Status, stored.GatewayRefundID, stored.Attempts, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssueGatewayRefundUnknownPayment(t *testing.T) {
+	useTestDB(t)
+	useFakeRazorpay(t)
+
+	refund := sourceRefund(t, "pay_unknown", 50000)
+	if err := issueGatewayRefund(&refund); err == nil {
+		t.Fatal("refund of an unknown payment succeeded")
+	}
+	var stored models.Refund
+	if err := configuration.DB.First(&stored, refund.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	// It is tried again by ReconcileRefunds
+	if stored.Status != models.RefundPending || stored.Attempts != 1 || stored.FailureReason == "" {
+		t.Errorf("refund is %s after %d attempts with reason %q, want pending after 1 attempt with the reason",
+			stored.Status, stored.Attempts, stored.FailureReason)
+	}
+}
+
+func TestReconcileRefunds(t *testing.T) {
+	useTestDB(t)
+	fake := useFakeRazorpay(t)
+	fake.RefundStatus = "pending"
+
+	// Refunds the gateway is still processing
+	processed := sourceRefund(t, capturedRazorpayPayment(t, fake, 50000), 50000)
+	failed := sourceRefund(t, capturedRazorpayPayment(t, fake, 30000), 30000)
+	stillPending := sourceRefund(t, capturedRazorpayPayment(t, fake, 20000), 20000)
+	for _, refund := range []*models.Refund{&processed, &failed, &stillPending} {
+		if err := issueGatewayRefund(refund); err != nil {
+			t.Fatalf("issueGatewayRefund: %v", err)
+		}
+	}
+	fake.SetRefundStatus(processed.GatewayRefundID, "processed")
+	fake.SetRefundStatus(failed.GatewayRefundID, "failed")
+
+	// A refund that couldn't be issued on its earlier attempts and fails its last one
+	exhausted := sourceRefund(t, "pay_unknown", 10000)
+	if err := configuration.DB.Model(&exhausted).Update("attempts", maxRefundAttempts-1).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := ReconcileRefunds()
+	if err == nil {
+		t.Error("ReconcileRefunds reported no error for the refund that couldn't be issued")
+	}
+	if changed != 3 {
+		t.Errorf("ReconcileRefunds changed %d refunds, want 3", changed)
+	}
+
+	want := map[uint]string{
+		processed.ID:    models.RefundProcessed,
+		failed.ID:       models.RefundFailed,
+		stillPending.ID: models.RefundPending,
+		exhausted.ID:    models.RefundFailed,
+	}
+	for id, status := range want {
+		var stored models.Refund
+		if err := configuration.DB.First(&stored, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != status {
+			t.Errorf("refund %d is %s, want %s", id, stored.Status, status)
+		}
+	}
+
+	var stored models.Refund
+	if err := configuration.DB.First(&stored, exhausted.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Attempts != maxRefundAttempts || stored.FailureReason == "" {
+		t.Errorf("exhausted refund has %d attempts and reason %q, want %d attempts with the reason",
+			stored.Attempts, stored.FailureReason, maxRefundAttempts)
+	}
+}
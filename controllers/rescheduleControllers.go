@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"doc-connect/access"
+	"doc-connect/configuration"
+	"doc-connect/lifecycle"
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// appointmentForCaller fetches an appointment the authenticated user may act on and reports
+// whether they act as the patient or for the doctor
+func appointmentForCaller(c *gin.Context, appointmentID string) (models.Appointment, string, bool) {
+	var appointment models.Appointment
+	if err := configuration.DB.Where("appointment_id = ?", appointmentID).First(&appointment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return appointment, "", false
+	}
+
+	// Appointments of others are answered as missing, so their ids can't be probed
+	p := principal(c)
+	err := access.Appointment(configuration.DB, p, appointment)
+	if errors.Is(err, access.ErrForbidden) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return appointment, "", false
+	} else if !authorized(c, err) {
+		return appointment, "", false
+	}
+
+	if p.Role == models.RolePatient {
+		return appointment, "patient", true
+	}
+	return appointment, "doctor", true
+}
+
+// RescheduleAppointment moves a confirmed appointment to another free slot of the same doctor.
+// The invoice and payment stay linked to the appointment.
+func RescheduleAppointment(c *gin.Context) {
+	var rescheduleRequest struct {
+		AppointmentDate     time.Time `json:"appointment_date" binding:"required"`
+		AppointmentTimeSlot string    `json:"appointment_time" binding:"required"`
+	}
+
+	if err := c.BindJSON(&rescheduleRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	appointment, rescheduledBy, ok := appointmentForCaller(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if appointment.BookingStatus != models.BookingConfirmed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only confirmed appointments can be rescheduled"})
+		return
+	}
+
+	// Check the reschedule cutoff window before the current slot
+	currentStart, err := slotStartTime(appointment.AppointmentDate, appointment.AppointmentTimeSlot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid time slot on appointment"})
+		return
+	}
+	cutoff := configuration.RescheduleCutoff()
+	if time.Now().Add(cutoff).After(currentStart) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Appointments can only be rescheduled up to %s before the slot", cutoff)})
+		return
+	}
+
+	newDate := rescheduleRequest.AppointmentDate
+	newTimeSlot := rescheduleRequest.AppointmentTimeSlot
+	if newDate.Equal(appointment.AppointmentDate) && newTimeSlot == appointment.AppointmentTimeSlot {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointment is already booked for this slot"})
+		return
+	}
+
+	// Check if the new slot is in the past
+	newStart, err := slotStartTime(newDate, newTimeSlot)
+	if err != nil || newStart.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointment date cannot be in the past"})
+		return
+	}
+
+	// Check if the new slot is within the available time slots of the doctor
+	doctorAvailability := getDoctorAvailability(appointment.DoctorID, newDate)
+	if doctorAvailability == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor availability not found"})
+		return
+	}
+	if !isTimeWithinAvailableSlot(newTimeSlot, generateTimeSlots(availabilityWindows(doctorAvailability))) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointment time slot not available"})
+		return
+	}
+
+	if !isAppointmentAvailable(appointment.DoctorID, newDate, newTimeSlot, appointment.AppointmentID) || isSlotOfferedToOther(appointment.DoctorID, newDate, newTimeSlot, appointment.PatientID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another Appointment has been already booked for the same date and time slot with the doctor"})
+		return
+	}
+
+	// A patient can't hold two appointments with the same doctor on the same day
+	if !newDate.Equal(appointment.AppointmentDate) && isDuplicateAppointment(appointment.PatientID, appointment.DoctorID, newDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Patient already has an appointment with the same doctor on that day"})
+		return
+	}
+
+	history := models.AppointmentReschedule{
+		AppointmentID:    appointment.AppointmentID,
+		PreviousDate:     appointment.AppointmentDate,
+		PreviousTimeSlot: appointment.AppointmentTimeSlot,
+		NewDate:          newDate,
+		NewTimeSlot:      newTimeSlot,
+		RescheduledBy:    rescheduledBy,
+	}
+
+	// Move the appointment and record the previous slot atomically, unless the new slot was
+	// taken meanwhile
+	err = configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimSlot(tx, appointment.DoctorID, newDate, newTimeSlot, appointment.AppointmentID); err != nil {
+			return err
+		}
+		// The appointment may have been cancelled, started or moved since it was read
+		result := tx.Model(&appointment).
+			Where("booking_status = ? AND appointment_date = ? AND appointment_time_slot = ?",
+				models.BookingConfirmed, appointment.AppointmentDate, appointment.AppointmentTimeSlot).
+			Updates(map[string]interface{}{
+				"appointment_date":      newDate,
+				"appointment_time_slot": newTimeSlot,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrStaleAppointment
+		}
+		return tx.Create(&history).Error
+	})
+	if errors.Is(err, lifecycle.ErrStaleAppointment) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Appointment was changed meanwhile, please retry"})
+		return
+	}
+	if errors.Is(err, errSlotTaken) || errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another Appointment has been already booked for the same date and time slot with the doctor"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reschedule appointment"})
+		return
+	}
+
+	appointment.AppointmentDate = newDate
+	appointment.AppointmentTimeSlot = newTimeSlot
+
+	notifyReschedule(appointment, history)
+
+	// Offer the previous slot to the waitlist
+	offerFreedSlot(appointment.DoctorID, history.PreviousDate, history.PreviousTimeSlot)
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Appointment rescheduled successfully",
+		"data":    appointment,
+		"history": history,
+	})
+}
+
+// GetRescheduleHistory lists the previous slots of an appointment
+func GetRescheduleHistory(c *gin.Context) {
+	appointment, _, ok := appointmentForCaller(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var history []models.AppointmentReschedule
+	if err := configuration.DB.Where("appointment_id = ?", appointment.AppointmentID).Order("created_at").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reschedule history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Reschedule history fetched successfully",
+		"data":    history,
+	})
+}
+
+// notifyReschedule emails the other party of the appointment about the new slot
+func notifyReschedule(appointment models.Appointment, history models.AppointmentReschedule) {
+	msg := fmt.Sprintf("Appointment #%d has been rescheduled by the %s from %s (%s) to %s (%s).",
+		appointment.AppointmentID, history.RescheduledBy,
+		history.PreviousDate.Format("2006-01-02"), history.PreviousTimeSlot,
+		history.NewDate.Format("2006-01-02"), history.NewTimeSlot)
+
+	recipient := appointment.PatientEmail
+	if history.RescheduledBy == "patient" {
+		var doctor models.Doctor
+		if err := configuration.DB.First(&doctor, appointment.DoctorID).Error; err != nil {
+			log.Println("Failed to fetch doctor for reschedule email:", err)
+			return
+		}
+		recipient = doctor.Email
+	}
+
+	if err := SendNotificationEmail("Appointment rescheduled", msg, recipient); err != nil {
+		log.Println("Failed to send reschedule email:", err)
+	}
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"doc-connect/authentication"
+	"doc-connect/models"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefreshToken exchanges a refresh token for a new access token and refresh token. The old
+// refresh token stops working.
+func RefreshToken(c *gin.Context) {
+	var refreshRequest struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.BindJSON(&refreshRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := authentication.RefreshSession(refreshRequest.RefreshToken)
+	if errors.Is(err, authentication.ErrInvalidToken) || errors.Is(err, authentication.ErrSessionRevoked) || errors.Is(err, authentication.ErrRefreshReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Token refreshed successfully",
+		"data":    tokens,
+	})
+}
+
+// ViewSessions lists the active sessions of the signed in user, on any device
+func ViewSessions(c *gin.Context) {
+	claims := sessionClaims(c)
+	sessions, err := authentication.ListSessions(claims.Role, claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Sessions fetched successfully",
+		"data":    sessions,
+	})
+}
+
+// RevokeSession signs the user out of one of their sessions
+func RevokeSession(c *gin.Context) {
+	claims := sessionClaims(c)
+	err := authentication.RevokeSession(claims.Role, claims.Subject, c.Param("id"))
+	if errors.Is(err, authentication.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Session revoked successfully",
+	})
+}
+
+// endCurrentSession revokes the session the request was made with
+func endCurrentSession(c *gin.Context) error {
+	claims := sessionClaims(c)
+	err := authentication.RevokeSession(claims.Role, claims.Subject, claims.SessionID)
+	if errors.Is(err, authentication.ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// sessionClaims are the access token claims the auth middleware verified
+func sessionClaims(c *gin.Context) *models.AuthClaims {
+	claims, _ := c.Get("claims")
+	return claims.(*models.AuthClaims)
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"doc-connect/access"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"doc-connect/razorpayfake"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testKeySecret     = "test-key-secret"
+	testWebhookSecret = "test-webhook-secret"
+)
+
+var migrateOnce sync.Once
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// useTestDB points the server at the postgres database of TEST_DATABASE_DSN and empties it.
+// Tests that need the database are skipped when it isn't set. The database is migrated like on
+// startup, so use a database created for the tests only.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	migrateOnce.Do(func() {
+		configuration.Settings.DB.DSN = dsn
+		configuration.ConfigDB()
+	})
+
+	tables, err := configuration.DB.Migrator().GetTables()
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	if err := configuration.DB.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE").Error; err != nil {
+		t.Fatalf("Failed to empty the database: %v", err)
+	}
+}
+
+// useFakeRazorpay makes Razorpay, served by a fresh fake Razorpay API, the payment provider
+func useFakeRazorpay(t *testing.T) *razorpayfake.Server {
+	t.Helper()
+	fake := razorpayfake.New()
+	server := httptest.NewServer(fake.Handler())
+
+	previous := configuration.Settings.Payments
+	configuration.Settings.Payments = configuration.PaymentsConfig{
+		Provider:              "razorpay",
+		RazorpayKeyID:         "rzp_test_key",
+		RazorpayKeySecret:     testKeySecret,
+		RazorpayWebhookSecret: testWebhookSecret,
+		RazorpayBaseURL:       server.URL,
+	}
+	configuration.InitPayments()
+	t.Cleanup(func() {
+		server.Close()
+		configuration.Settings.Payments = previous
+		configuration.InitPayments()
+	})
+	return fake
+}
+
+// withPrincipal authenticates every request of a test router as p, in place of the auth middlewares
+func withPrincipal(p access.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch p.Role {
+		case models.RolePatient:
+			c.Set("patientID", p.PatientID)
+		case models.RoleDoctor:
+			c.Set("doctor_id", p.DoctorID)
+		}
+		access.SetPrincipal(c, p)
+		c.Next()
+	}
+}
+
+// createPendingBooking stores a pending booking of a patient with a doctor and its unpaid invoice
+func createPendingBooking(t *testing.T, patientID int, doctorID uint, total money.Amount) (models.Appointment, models.Invoice) {
+	t.Helper()
+	holdExpiresAt := time.Now().Add(time.Hour)
+	appointment := models.Appointment{
+		PatientID:           patientID,
+		DoctorID:            int(doctorID),
+		PatientEmail:        fmt.Sprintf("patient%d@example.com", patientID),
+		AppointmentDate:     time.Now().AddDate(0, 0, 1).Truncate(24 * time.Hour),
+		AppointmentTimeSlot: fmt.Sprintf("%02d:00-%02d:30", 9+patientID%8, 9+patientID%8),
+		PaymentStatus:       models.AppointmentPaymentPending,
+		BookingStatus:       models.BookingPending,
+		HoldExpiresAt:       &holdExpiresAt,
+	}
+	if err := configuration.DB.Create(&appointment).Error; err != nil {
+		t.Fatalf("Failed to create appointment: %v", err)
+	}
+
+	invoice := models.Invoice{
+		DoctorID:       doctorID,
+		PatientID:      uint(patientID),
+		AppointmentID:  uint(appointment.AppointmentID),
+		TotalAmount:    total,
+		Subtotal:       total,
+		Currency:       money.INR,
+		PaymentStatus:  models.InvoicePending,
+		PaymentDueDate: holdExpiresAt,
+	}
+	if err := configuration.DB.Create(&invoice).Error; err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	return appointment, invoice
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/lifecycle"
+	"doc-connect/models"
+	"doc-connect/money"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errSlotTaken is returned when a slot overlaps a live booking of the doctor
+var errSlotTaken = errors.New("slot overlaps a live booking")
+
+// slotTaken limits an appointment query to bookings that keep their slot taken: every
+// booking that isn't cancelled, except pending ones whose payment hold has expired
+func slotTaken(db *gorm.DB) *gorm.DB {
+	return db.Where("(booking_status IN (?, ?, ?, ?) OR (booking_status = ? AND hold_expires_at > ?))",
+		models.BookingConfirmed, models.BookingInConsultation, models.BookingCompleted, models.BookingNoShow,
+		models.BookingPending, time.Now())
+}
+
+// reserveSlot creates a pending booking holding its slot until the invoice is due, together
+// with the invoice of the given line items, atomically. A coupon code, if given, is applied
+// to the invoice and the booking fails if the coupon can't be applied. It fails with
+// errSlotTaken if the slot overlaps a live booking of the doctor.
+func reserveSlot(booking *models.Appointment, items []models.InvoiceItem, couponCode string, prepaymentRequired bool, actor string) (models.Invoice, error) {
+	holdExpiresAt := time.Now().Add(configuration.PaymentHoldDuration())
+	booking.BookingStatus = models.BookingPending
+	booking.PaymentStatus = models.AppointmentPaymentPending
+	booking.HoldExpiresAt = &holdExpiresAt
+
+	var invoice models.Invoice
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimSlot(tx, booking.DoctorID, booking.AppointmentDate, booking.AppointmentTimeSlot, 0); err != nil {
+			return err
+		}
+
+		// Create the appointment
+		if err := tx.Create(booking).Error; err != nil {
+			return err
+		}
+		if err := lifecycle.Created(tx, booking, actor); err != nil {
+			return err
+		}
+
+		// Create the invoice
+		invoice = models.Invoice{
+			DoctorID:           uint(booking.DoctorID),
+			PatientID:          uint(booking.PatientID),
+			AppointmentID:      uint(booking.AppointmentID),
+			Currency:           money.INR,
+			PaymentMethod:      "Pending", // Payment method set to pending initially
+			PaymentStatus:      models.InvoicePending,
+			PaymentDueDate:     holdExpiresAt,
+			PrepaymentRequired: prepaymentRequired,
+			Items:              items,
+		}
+		totalInvoice(&invoice)
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+
+		if couponCode != "" {
+			_, err := applyCoupon(tx, &invoice, couponCode)
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		err = errSlotTaken
+	}
+	return invoice, err
+}
+
+// claimSlot makes sure a slot of a doctor's day can be booked, or an appointment moved to it,
+// within a transaction. Bookings of a doctor are claimed one at a time, so two overlapping
+// slots can't both be booked even when the doctor changed the length of their slots. Expired
+// holds of the slot are released; it fails with errSlotTaken if the slot overlaps a live
+// booking other than the given appointment.
+func claimSlot(tx *gorm.DB, doctorID int, date time.Time, timeSlot string, exceptAppointmentID int) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("doctor_id").First(&models.Doctor{}, doctorID).Error; err != nil {
+		return err
+	}
+	if err := releaseExpiredHolds(tx, doctorID, date, timeSlot); err != nil {
+		return err
+	}
+	taken, err := bookedTimeSlots(tx, doctorID, date, exceptAppointmentID)
+	if err != nil {
+		return err
+	}
+	if overlapsAny(timeSlot, taken) {
+		return errSlotTaken
+	}
+	return nil
+}
+
+// bookedTimeSlots returns the slots of a doctor's day held by live bookings other than the
+// given appointment
+func bookedTimeSlots(tx *gorm.DB, doctorID int, date time.Time, exceptAppointmentID int) ([]string, error) {
+	var taken []string
+	err := tx.Model(&models.Appointment{}).Scopes(slotTaken).
+		Where("doctor_id = ? AND appointment_date = ? AND appointment_id <> ?", doctorID, date, exceptAppointmentID).
+		Pluck("appointment_time_slot", &taken).Error
+	return taken, err
+}
+
+// slotMinutes returns when a "HH:MM-HH:MM" slot starts and ends, in minutes of the day
+func slotMinutes(timeSlot string) (int, int, bool) {
+	startTime, endTime := splitAvailabilityTime(timeSlot)
+	start, err := time.Parse("15:04", startTime)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err := time.Parse("15:04", endTime)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), true
+}
+
+// slotsOverlap reports whether two slots share any time. Slots that can't be parsed only
+// overlap themselves.
+func slotsOverlap(a, b string) bool {
+	aStart, aEnd, aOK := slotMinutes(a)
+	bStart, bEnd, bOK := slotMinutes(b)
+	if !aOK || !bOK {
+		return a == b
+	}
+	return aStart < bEnd && bStart < aEnd
+}
+
+// overlapsAny reports whether a slot overlaps any of the taken slots
+func overlapsAny(timeSlot string, taken []string) bool {
+	for _, other := range taken {
+		if slotsOverlap(timeSlot, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseExpiredHolds cancels the pending bookings of a slot whose payment window has
+// passed, so the slot can be reserved again
+func releaseExpiredHolds(tx *gorm.DB, doctorID int, date time.Time, timeSlot string) error {
+	var expired []models.Appointment
+	if err := tx.Where("doctor_id = ? AND appointment_date = ? AND appointment_time_slot = ? AND booking_status = ? AND hold_expires_at <= ?",
+		doctorID, date, timeSlot, models.BookingPending, time.Now()).Find(&expired).Error; err != nil {
+		return err
+	}
+
+	for i := range expired {
+		if _, err := expireBooking(tx, &expired[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireBooking marks the unpaid invoice of a booking as expired and cancels the pending
+// booking, which frees its slot. The wallet part of a partially paid invoice goes back to the
+// wallet. It reports whether the booking was cancelled; a booking that was paid or cancelled
+// meanwhile is left alone.
+func expireBooking(tx *gorm.DB, appointment *models.Appointment) (bool, error) {
+	if appointment.BookingStatus != models.BookingPending {
+		return false, nil
+	}
+	err := lifecycle.Transition(tx, appointment, lifecycle.Change{
+		To:            models.BookingCancelled,
+		PaymentStatus: models.AppointmentPaymentExpired,
+		Actor:         "system",
+		Reason:        "payment window expired",
+	})
+	if errors.Is(err, lifecycle.ErrStaleAppointment) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var partiallyPaid models.Invoice
+	err = tx.Where("appointment_id = ? AND payment_status = ?", appointment.AppointmentID, models.InvoicePartiallyPaid).First(&partiallyPaid).Error
+	if err == nil {
+		if err := reverseWalletPayments(tx, &partiallyPaid); err != nil {
+			return false, err
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	if err := releaseCouponRedemptions(tx, appointment.AppointmentID); err != nil {
+		return false, err
+	}
+	if err := tx.Model(&models.Invoice{}).Where("appointment_id = ? AND payment_status = ?", appointment.AppointmentID, models.InvoicePending).
+		Update("payment_status", models.InvoiceExpired).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// paymentWindowExpired reports whether an unpaid invoice can no longer be paid because
+// the slot hold of its booking has run out
+func paymentWindowExpired(invoice models.Invoice) bool {
+	return invoice.PaymentStatus == models.InvoiceExpired || time.Now().After(invoice.PaymentDueDate)
+}
+
+// slotStartTime returns when a "HH:MM-HH:MM" slot on the given date starts
+func slotStartTime(date time.Time, timeSlot string) (time.Time, error) {
+	start, err := time.Parse("15:04", strings.TrimSpace(strings.Split(timeSlot, "-")[0]))
+	if err != nil {
+		return time.Time{}, errors.New("invalid time slot")
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), start.Hour(), start.Minute(), 0, 0, time.Local), nil
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import "testing"
+
+func TestSlotsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"10:00-10:30", "10:00-10:30", true},
+		{"10:00-10:30", "10:15-10:45", true},
+		{"10:00-11:00", "10:20-10:40", true},
+		{"10:00-10:30", "10:30-11:00", false},
+		{"10:30-11:00", "10:00-10:30", false},
+		{"10:00-10:30", "11:00-11:30", false},
+		{"morning", "morning", true},
+		{"morning", "10:00-10:30", false},
+	}
+	for _, tt := range tests {
+		if got := slotsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("slotsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ViewHospitalDoctors lists the doctors of the hospital of the signed in staff member
+func ViewHospitalDoctors(c *gin.Context) {
+	var doctors []models.Doctor
+	if err := configuration.DB.Where("hospital_id = ?", principal(c).HospitalID).Order("doctor_id").Find(&doctors).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch doctors"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Doctors fetched successfully",
+		"data":    doctors,
+	})
+}
+
+// ViewHospitalAppointments lists the appointments of the hospital's doctors on a day, today by
+// default
+func ViewHospitalAppointments(c *gin.Context) {
+	date := time.Now().Format("2006-01-02")
+	if dateStr := c.Query("date"); dateStr != "" {
+		if _, err := time.Parse("2006-01-02", dateStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		date = dateStr
+	}
+
+	var appointments []models.Appointment
+	if err := configuration.DB.Joins("JOIN doctors ON doctors.doctor_id = appointments.doctor_id").
+		Where("doctors.hospital_id = ? AND appointments.appointment_date = ?", principal(c).HospitalID, date).
+		Order("appointments.doctor_id, appointments.appointment_time_slot").
+		Find(&appointments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Appointments fetched successfully",
+		"data":    appointments,
+	})
+}
+
+// GetHospitalReport reports the bookings and revenue of the hospital's doctors between two
+// dates, the current month by default
+func GetHospitalReport(c *gin.Context) {
+	now := time.Now()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	endDate := now
+	var err error
+	if startDateStr := c.Query("start_date"); startDateStr != "" {
+		if startDate, err = time.Parse("2006-01-02", startDateStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+			return
+		}
+	}
+	if endDateStr := c.Query("end_date"); endDateStr != "" {
+		if endDate, err = time.Parse("2006-01-02", endDateStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+			return
+		}
+	}
+	hospitalID := principal(c).HospitalID
+
+	// Bookings of each doctor by status, by the day of the appointment
+	var bookings []struct {
+		DoctorID      uint   `json:"doctor_id"`
+		BookingStatus string `json:"booking_status"`
+		BookingCount  int64  `json:"booking_count"`
+	}
+	if err := configuration.DB.Table("appointments").
+		Select("appointments.doctor_id, appointments.booking_status, COUNT(*) as booking_count").
+		Joins("JOIN doctors ON doctors.doctor_id = appointments.doctor_id").
+		Where("doctors.hospital_id = ? AND appointments.appointment_date BETWEEN ? AND ?", hospitalID, startDate, endDate).
+		Group("appointments.doctor_id, appointments.booking_status").
+		Order("appointments.doctor_id").
+		Scan(&bookings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bookings"})
+		return
+	}
+
+	// Revenue of each doctor from the invoices paid in the period
+	var revenue []struct {
+		DoctorID     uint         `json:"doctor_id"`
+		InvoiceCount int64        `json:"invoice_count"`
+		TotalRevenue money.Amount `json:"total_revenue"`
+		Currency     string       `json:"currency"`
+	}
+	if err := configuration.DB.Table("invoices").
+		Select("invoices.doctor_id, COUNT(*) as invoice_count, SUM(invoices.total_amount) as total_revenue, invoices.currency").
+		Joins("JOIN doctors ON doctors.doctor_id = invoices.doctor_id").
+		Where("doctors.hospital_id = ? AND invoices.payment_status = ?", hospitalID, models.InvoicePaid).
+		Where("invoices.updated_at BETWEEN ? AND ?", startDate, endDate.AddDate(0, 0, 1)).
+		Group("invoices.doctor_id, invoices.currency").
+		Order("invoices.doctor_id").
+		Scan(&revenue).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revenue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":     "Success",
+		"Message":    "Hospital report fetched successfully",
+		"start_date": startDate.Format("2006-01-02"),
+		"end_date":   endDate.Format("2006-01-02"),
+		"bookings":   bookings,
+		"revenue":    revenue,
+	})
+}
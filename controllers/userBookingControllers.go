@@ -8,7 +8,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,45 +35,60 @@ func GetAvailableTimeSlots(c *gin.Context) {
 		return
 	}
 
-	// Query database for doctor's availability on the specified date
-	var availability models.DoctorAvailability
-	if err := configuration.DB.Where("doctor_id = ? AND date = ?", doctorID, date).First(&availability).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Availability not found"})
+	id, err := strconv.Atoi(doctorID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
 		return
 	}
 
-	// Split availability time into start and end time
-	startTime, endTime := splitAvailabilityTime(availability.AvilableTime)
+	// Resolve doctor's availability on the specified date
+	availability := getDoctorAvailability(id, date)
+	if availability == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Availability not found"})
+		return
+	}
 
-	// Divide time between start and end time into 30-minute intervals to create time slots
-	availableTimeSlots := divideSlots(startTime, endTime, 30*time.Minute)
+	patientID, _ := c.Get("patientID")
+	patient, _ := patientID.(int)
 
-	// Query database for existing bookings for the doctor on the specified date
-	var bookings []models.Appointment
-	if err := configuration.DB.Where("doctor_id = ? AND appointment_date = ? AND (booking_status = ? OR booking_status = ?)", doctorID, date, "confirmed", "completed").Find(&bookings).Error; err != nil {
+	// Free slots of the day, leaving out booked slots and slots offered to waitlisted patients
+	adjustedTimeSlots, err := freeTimeSlots(id, date, availability, patient)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
 		return
 	}
 
-	//Map to store booked time slots
-	bookedTimeSlots := make(map[string]bool)
-	for _, booking := range bookings {
-		bookedTimeSlots[booking.AppointmentTimeSlot] = true
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "Time slots fetched successfully",
+		"date":                 dateStr,
+		"available_time_slots": adjustedTimeSlots,
+	})
+}
+
+// freeTimeSlots divides the availability windows of a doctor's day into slots and leaves out
+// slots overlapping live bookings and slots offered to waitlisted patients other than the
+// given one. Bookings made before the doctor changed their slots may overlap several slots.
+func freeTimeSlots(doctorID int, date time.Time, availability *models.DoctorAvailability, patientID int) ([]string, error) {
+	// Divide every availability window into slots of the window's length
+	availableTimeSlots := generateTimeSlots(availabilityWindows(availability))
+
+	// Query database for existing bookings for the doctor on the specified date
+	taken, err := bookedTimeSlots(configuration.DB, doctorID, date, 0)
+	if err != nil {
+		return nil, err
+	}
+	for slot := range offeredTimeSlots(configuration.DB, doctorID, date, patientID) {
+		taken = append(taken, slot)
 	}
 
 	// Filter out available time slots that are already booked
-	adjustedTimeSlots := make([]string, 0)
+	freeSlots := make([]string, 0)
 	for _, slot := range availableTimeSlots {
-		if !bookedTimeSlots[slot] {
-			adjustedTimeSlots = append(adjustedTimeSlots, slot)
+		if !overlapsAny(slot, taken) {
+			freeSlots = append(freeSlots, slot)
 		}
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":              "Time slots fetched successfully",
-		"date":                 dateStr,
-		"available_time_slots": adjustedTimeSlots,
-	})
+	return freeSlots, nil
 }
 
 // splits availability time string into start and end time
@@ -86,24 +101,6 @@ func splitAvailabilityTime(availabilityTime string) (startTime, endTime string)
 	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 }
 
-// Dividing time between start and end time into time slots with specified interval
-func divideSlots(startTime, endTime string, interval time.Duration) []string {
-
-	// Parse start and end time strings into time.Time objects
-	start, _ := time.Parse("15:04", startTime)
-	end, _ := time.Parse("15:04", endTime)
-
-	// Initialize slice to store time slot strings
-	var slots []string
-
-	// Initialize slice to store time slot strings
-	for t := start; t.Before(end); t = t.Add(interval) {
-		slotEnd := t.Add(interval)
-		slots = append(slots, fmt.Sprintf("%s-%s", t.Format("15:04"), slotEnd.Format("15:04")))
-	}
-	return slots
-}
-
 // Information about doctor
 type DoctorInfo struct {
 	Name       string `json:"name"`
@@ -195,8 +192,8 @@ func BookAppointment(c *gin.Context) {
 		return
 	}
 
-	// Divide available time slots into smaller slots
-	availableTimeSlots := divideAvailableSlots(doctorAvailability.AvilableTime, 30*time.Minute)
+	// Divide the doctor's availability windows into slots
+	availableTimeSlots := generateTimeSlots(availabilityWindows(doctorAvailability))
 
 	// Check if the appointment time slot is within the available time slots
 	if !isTimeWithinAvailableSlot(booking.AppointmentTimeSlot, availableTimeSlots) {
@@ -205,11 +202,17 @@ func BookAppointment(c *gin.Context) {
 	}
 
 	// Check for existing appointments with the same date and time slot
-	if !isAppointmentAvailable(booking.DoctorID, booking.AppointmentDate, booking.AppointmentTimeSlot) {
+	if !isAppointmentAvailable(booking.DoctorID, booking.AppointmentDate, booking.AppointmentTimeSlot, 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Another Appointment has been already booked for the same date and time slot with the doctor"})
 		return
 	}
 
+	// Check if the slot is offered to a patient from the waitlist
+	if isSlotOfferedToOther(booking.DoctorID, booking.AppointmentDate, booking.AppointmentTimeSlot, booking.PatientID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointment time slot is offered to a waitlisted patient"})
+		return
+	}
+
 	// Check if the patient exists
 	var patient models.Patient
 	if err := configuration.DB.Where("patient_id = ?", booking.PatientID).First(&patient).Error; err != nil {
@@ -223,11 +226,14 @@ func BookAppointment(c *gin.Context) {
 		return
 	}
 
-	// Create the appointment
-	booking.BookingStatus = "pending"
-	booking.PaymentStatus = "pending"
-	if err := configuration.DB.Create(&booking).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to book appointment"})
+	// Apply the booking policy for patients with repeated no-shows
+	prepaymentRequired, err := applyNoShowPolicy(booking.PatientID)
+	if errors.Is(err, errBookingBlocked) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Booking is blocked after repeated no-shows, please contact the hospital"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check booking policy"})
 		return
 	}
 
@@ -238,22 +244,18 @@ func BookAppointment(c *gin.Context) {
 		return
 	}
 
-	// Calculate total amount for the invoice
-	totalAmount := doctor.ConsultancyCharge
-
-	// Create the invoice
-	invoice := models.Invoice{
-		DoctorID:       uint(booking.DoctorID),
-		PatientID:      uint(booking.PatientID),
-		AppointmentID:  uint(booking.AppointmentID),
-		TotalAmount:    float64(totalAmount) + 50,
-		PaymentMethod:  "Pending", // Payment method set to pending initially
-		PaymentStatus:  "Pending",
-		PaymentDueDate: time.Now().AddDate(0, 0, 1), // Payment due date set to 1 day from now
+	// Reserve the slot and create the invoice
+	invoice, err := reserveSlot(&booking, bookingInvoiceItems(doctor), c.Query("coupon_code"), prepaymentRequired, actorFromContext(c))
+	if errors.Is(err, errSlotTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another Appointment has been already booked for the same date and time slot with the doctor"})
+		return
 	}
-
-	if err := configuration.DB.Create(&invoice).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invoice"})
+	if errors.Is(err, errCouponNotFound) || errors.Is(err, errCouponNotApplicable) {
+		couponFailed(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to book appointment"})
 		return
 	}
 
@@ -279,13 +281,39 @@ func BookAppointment(c *gin.Context) {
 	})
 }
 
-// getDoctorAvailability retrieves the availability of a doctor on a specific date
+// getDoctorAvailability resolves the availability of a doctor on a specific date.
+// A blackout date wins over everything, then a per-date availability, then the weekly schedule.
 func getDoctorAvailability(doctorID int, date time.Time) *models.DoctorAvailability {
+	// Check if the doctor is on leave for the date
+	var blackout models.DoctorBlackout
+	if err := configuration.DB.Where("doctor_id = ? AND date = ?", doctorID, date).First(&blackout).Error; err == nil {
+		return nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println("Error checking for blackout date:", err)
+		return nil
+	}
+
+	// Per-date availability overrides the weekly schedule
 	var availability models.DoctorAvailability
-	if err := configuration.DB.Where("doctor_id = ? AND date = ?", doctorID, date).First(&availability).Error; err != nil {
+	if err := configuration.DB.Preload("Windows").Where("doctor_id = ? AND date = ?", doctorID, date).First(&availability).Error; err == nil {
+		return &availability
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println("Error fetching doctor availability:", err)
+		return nil
+	}
+
+	// Expand the weekly schedule effective on the date
+	var schedule models.DoctorWeeklySchedule
+	if err := configuration.DB.Preload("Windows").Where("doctor_id = ? AND weekday = ? AND effective_from <= ? AND (effective_until IS NULL OR effective_until >= ?)", doctorID, int(date.Weekday()), date, date).
+		Order("effective_from DESC").First(&schedule).Error; err != nil {
 		return nil
 	}
-	return &availability
+	return &models.DoctorAvailability{
+		DoctorID:     uint(doctorID),
+		Date:         date,
+		AvilableTime: schedule.AvailableTime,
+		Windows:      schedule.Windows,
+	}
 }
 
 // isTimeWithinAvailableSlot checks if the appointment time slot falls within the available time slots
@@ -298,52 +326,21 @@ func isTimeWithinAvailableSlot(appointmentTimeSlot string, availableSlots []stri
 	return false
 }
 
-func isAppointmentAvailable(doctorID int, date time.Time, appointmentTimeSlot string) bool {
-	var existingAppointment models.Appointment
-	err := configuration.DB.Where("doctor_id = ? AND appointment_date = ? AND appointment_time_slot = ?", doctorID, date, appointmentTimeSlot).First(&existingAppointment).Error
-	if err == nil {
-		// Check for confirmed or completed appointments
-		if existingAppointment.BookingStatus == "confirmed" || existingAppointment.BookingStatus == "completed" {
-			return false // Appointment already booked
-		}
-		// Appointment available if pending or cancelled
-		return true
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+// isAppointmentAvailable checks if no live booking other than the given appointment overlaps
+// the slot. Cancelled and expired pending bookings free their slot.
+func isAppointmentAvailable(doctorID int, date time.Time, appointmentTimeSlot string, exceptAppointmentID int) bool {
+	taken, err := bookedTimeSlots(configuration.DB, doctorID, date, exceptAppointmentID)
+	if err != nil {
 		// Unexpected error
 		log.Println("Error checking for existing appointment:", err)
 		return false
 	}
-	// No existing appointment, slot is available
-	fmt.Println(existingAppointment.BookingStatus)
-	return true
-}
-
-// divideAvailableSlots divides the available time slots of a doctor into smaller time slots based on the specified interval
-func divideAvailableSlots(availability string, interval time.Duration) []string {
-	// Extract start and end times from the availability string
-	parts := strings.Split(availability, "-")
-	if len(parts) != 2 {
-		fmt.Println("Invalid availability format")
-		return nil
-	}
-	startTime := parts[0]
-	endTime := parts[1]
-
-	// Parse start and end times
-	start, _ := time.Parse("15:04", startTime)
-	end, _ := time.Parse("15:04", endTime)
-
-	var slots []string
-	for t := start; t.Before(end); t = t.Add(interval) {
-		slotEnd := t.Add(interval)
-		slots = append(slots, fmt.Sprintf("%s-%s", t.Format("15:04"), slotEnd.Format("15:04")))
-	}
-	return slots
+	return !overlapsAny(appointmentTimeSlot, taken)
 }
 
 func isDuplicateAppointment(patientID int, doctorID int, date time.Time) bool {
 	var existingAppointments []models.Appointment
-	err := configuration.DB.Where("patient_id = ? AND doctor_id = ? AND appointment_date = ? AND booking_status IN (?, ?, ?)", patientID, doctorID, date, "pending", "confirmed", "completed").Find(&existingAppointments).Error
+	err := configuration.DB.Scopes(slotTaken).Where("patient_id = ? AND doctor_id = ? AND appointment_date = ?", patientID, doctorID, date).Find(&existingAppointments).Error
 	if err != nil {
 		log.Println("Error checking for existing appointments:", err)
 		return true // Return true to indicate an error occurred
@@ -386,13 +383,11 @@ func generateDuePDFInvoice(booking models.Appointment, invoice models.Invoice, d
 	pdf.CellFormat(0, 10, "Invoice Details", "1", 1, "C", false, 0, "")
 	addDetail(pdf, "Booking Status", booking.BookingStatus, false)
 	addDetail(pdf, "Due date", invoice.PaymentDueDate.Format("2006-01-02"), false)
-	// CGST and SGST (0)
-	addDetail(pdf, "CGST (0%)", "0.00", false)
-	addDetail(pdf, "SGST (0%)", "0.00", false)
+	addInvoiceLines(pdf, invoice)
 	pdf.SetFont("Arial", "B", 13)
-	addDetail(pdf, "Grand Total", fmt.Sprintf("%.2f", invoice.TotalAmount), true)
+	addDetail(pdf, "Grand Total", invoice.Total().String(), true)
 	pdf.SetTextColor(139, 128, 0) // Yellow color for total amount
-	addDetail(pdf, "Balance due", fmt.Sprintf("%.2f", invoice.TotalAmount), true)
+	addDetail(pdf, "Balance due", invoice.Total().String(), true)
 
 	// Payment instructions
 	pdf.SetTextColor(0, 0, 0) // Reset text color to black
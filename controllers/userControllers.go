@@ -4,10 +4,11 @@ import (
 	"doc-connect/authentication"
 	"doc-connect/configuration"
 	"doc-connect/models"
+	"doc-connect/money"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/twilio/twilio-go"
@@ -43,18 +44,20 @@ func PatientLogin(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token for the patient
-	token, err := authentication.GeneratePatientToken(existingPatient.PatientID, loginReq.Phone)
+	// Start a session for the patient
+	tokens, err := authentication.StartSession(c, models.RolePatient, strconv.Itoa(existingPatient.PatientID), existingPatient.Phone)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Return the token
+	// Return the tokens
 	c.JSON(http.StatusOK, gin.H{
-		"Status":  "Success",
-		"message": "Login sucessful",
-		"token":   token,
+		"Status":        "Success",
+		"message":       "Login sucessful",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -112,8 +115,8 @@ func PatientSignup(c *gin.Context) {
 
 // Function to send OTP to the patient's phone number
 func SendOTP(phoneNumber string) error {
-	accountSID := os.Getenv("TWILIO_ACCOUNT_SID")
-	authToken := os.Getenv("TWILIO_AUTHTOKEN")
+	accountSID := configuration.Settings.Twilio.AccountSID
+	authToken := configuration.Settings.Twilio.AuthToken
 
 	// Initialize Twilio client
 	client := twilio.NewRestClientWithParams(twilio.ClientParams{
@@ -122,12 +125,12 @@ func SendOTP(phoneNumber string) error {
 	})
 
 	//create SMS message for OTP verification
-	from := os.Getenv("TWILIO_PHONENUMBER")
+	from := configuration.Settings.Twilio.PhoneNumber
 	params := verify.CreateVerificationParams{}
 	params.SetTo("+918762334325")
 	params.SetChannel("sms")
 	println(from)
-	response, err := client.VerifyV2.CreateVerification(os.Getenv("TWILIO_SERVIES_ID"), &params)
+	response, err := client.VerifyV2.CreateVerification(configuration.Settings.Twilio.ServiceID, &params)
 	if err != nil {
 		fmt.Println(err.Error())
 		return err
@@ -138,8 +141,8 @@ func SendOTP(phoneNumber string) error {
 
 // Function to verify OTP and create patient record
 func UserOtpVerify(c *gin.Context) {
-	accountSID := os.Getenv("TWILIO_ACCOUNT_SID")
-	authToken := os.Getenv("TWILIO_AUTHTOKEN")
+	accountSID := configuration.Settings.Twilio.AccountSID
+	authToken := configuration.Settings.Twilio.AuthToken
 
 	// Bind OTP verification request data
 	var OTPverify models.VerifyOTP
@@ -167,7 +170,7 @@ func UserOtpVerify(c *gin.Context) {
 	params.SetCode(OTPverify.Otp)
 
 	// Verify OTP with Twilio
-	response, err := client.VerifyV2.CreateVerificationCheck(os.Getenv("TWILIO_SERVIES_ID"), &params)
+	response, err := client.VerifyV2.CreateVerificationCheck(configuration.Settings.Twilio.ServiceID, &params)
 	if err != nil {
 		fmt.Println("err", err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"Status": false, "Data": nil, "Message": "error in veifying provided OTP"})
@@ -208,8 +211,9 @@ func UserOtpVerify(c *gin.Context) {
 
 	// Create wallet for the user with balance 0
 	wallet := models.Wallet{
-		UserID: userData.PatientID,
-		Amount: 0,
+		UserID:   userData.PatientID,
+		Amount:   0,
+		Currency: money.INR,
 	}
 
 	// Create wallet record
@@ -227,5 +231,9 @@ func UserOtpVerify(c *gin.Context) {
 
 // User logout
 func PatientLogout(c *gin.Context) {
+	if err := endCurrentSession(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "You are successfully logged out"})
 }
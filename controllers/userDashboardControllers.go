@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"doc-connect/access"
 	"doc-connect/configuration"
 	"doc-connect/models"
 	"errors"
@@ -13,6 +14,9 @@ import (
 func GetAppointmenentHistory(c *gin.Context) {
 	var appointmentHistory []models.Appointment
 	patientID := c.Param("id")
+	if !authorized(c, access.PatientParam(principal(c), patientID)) {
+		return
+	}
 
 	if err := configuration.DB.Where("patient_id = ?", patientID).Find(&appointmentHistory).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JoinWaitlist queues the patient for a doctor's day that has no free slot left
+func JoinWaitlist(c *gin.Context) {
+	var waitlistRequest struct {
+		DoctorID           int    `json:"doctor_id" binding:"required"`
+		Date               string `json:"date" binding:"required"`
+		PatientEmail       string `json:"email" binding:"required"`
+		PatientHealthIssue string `json:"patient_health_issue"`
+	}
+
+	if err := c.BindJSON(&waitlistRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patientID, ok := c.Get("patientID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Patient not authenticated"})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", waitlistRequest.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+	if date.Before(time.Now().Truncate(24 * time.Hour)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date cannot be in the past"})
+		return
+	}
+
+	// Only fully booked days have a waitlist
+	availability := getDoctorAvailability(waitlistRequest.DoctorID, date)
+	if availability == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Availability not found"})
+		return
+	}
+	freeSlots, err := freeTimeSlots(waitlistRequest.DoctorID, date, availability, patientID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+	if len(freeSlots) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time slots are still available, book one directly", "available_time_slots": freeSlots})
+		return
+	}
+
+	// Check if the patient is already on the waitlist
+	var existingEntry models.WaitlistEntry
+	if err := configuration.DB.Where("patient_id = ? AND doctor_id = ? AND date = ? AND status IN (?, ?)", patientID, waitlistRequest.DoctorID, date, "waiting", "offered").First(&existingEntry).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are already on the waitlist for this day"})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check waitlist"})
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		PatientID:          patientID.(int),
+		DoctorID:           waitlistRequest.DoctorID,
+		Date:               date,
+		PatientEmail:       waitlistRequest.PatientEmail,
+		PatientHealthIssue: waitlistRequest.PatientHealthIssue,
+		Status:             "waiting",
+	}
+	if err := configuration.DB.Create(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join waitlist"})
+		return
+	}
+
+	// Position of the patient in the queue
+	var position int64
+	configuration.DB.Model(&models.WaitlistEntry{}).Where("doctor_id = ? AND date = ? AND status = ? AND id <= ?", entry.DoctorID, entry.Date, "waiting", entry.ID).Count(&position)
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":   "Success",
+		"Message":  "Added to the waitlist successfully",
+		"data":     entry,
+		"position": position,
+	})
+}
+
+// ViewWaitlist lists the waitlist entries of the patient
+func ViewWaitlist(c *gin.Context) {
+	patientID, ok := c.Get("patientID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Patient not authenticated"})
+		return
+	}
+
+	var entries []models.WaitlistEntry
+	if err := configuration.DB.Where("patient_id = ?", patientID).Order("created_at DESC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Waitlist fetched successfully",
+		"data":    entries,
+	})
+}
+
+// LeaveWaitlist removes the patient from a waitlist. A pending offer moves to the next patient.
+func LeaveWaitlist(c *gin.Context) {
+	patientID, ok := c.Get("patientID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Patient not authenticated"})
+		return
+	}
+
+	var entry models.WaitlistEntry
+	if err := configuration.DB.Where("id = ? AND patient_id = ? AND status IN (?, ?)", c.Param("id"), patientID, "waiting", "offered").First(&entry).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist entry not found"})
+		return
+	}
+
+	wasOffered := entry.Status == "offered"
+	if err := configuration.DB.Model(&entry).Update("status", "cancelled").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave waitlist"})
+		return
+	}
+
+	if wasOffered {
+		offerFreedSlot(entry.DoctorID, entry.Date, entry.OfferedTimeSlot)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Removed from the waitlist successfully",
+	})
+}
+
+// ClaimWaitlistOffer books the slot offered to a waitlisted patient with the emailed claim token.
+// It is a POST so that mail clients and link previews fetching the offer can't claim it.
+func ClaimWaitlistOffer(c *gin.Context) {
+	var claimRequest struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&claimRequest); err != nil || claimRequest.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Claim token is required"})
+		return
+	}
+	token := claimRequest.Token
+
+	var entry models.WaitlistEntry
+	if err := configuration.DB.Where("offer_token = ? AND status = ?", token, "offered").First(&entry).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Offer not found or no longer valid"})
+		return
+	}
+
+	if entry.OfferExpiresAt == nil || time.Now().After(*entry.OfferExpiresAt) {
+		expireWaitlistOffer(entry)
+		c.JSON(http.StatusGone, gin.H{"error": "Offer has expired"})
+		return
+	}
+
+	if !isAppointmentAvailable(entry.DoctorID, entry.Date, entry.OfferedTimeSlot, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Offered slot is no longer available"})
+		return
+	}
+
+	if isDuplicateAppointment(entry.PatientID, entry.DoctorID, entry.Date) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Your Appointment has been already booked with the same doctor in the same day"})
+		return
+	}
+
+	var patient models.Patient
+	if err := configuration.DB.Where("patient_id = ?", entry.PatientID).First(&patient).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wrong patient ID"})
+		return
+	}
+
+	var doctor models.Doctor
+	if err := configuration.DB.Where("doctor_id = ?", entry.DoctorID).First(&doctor).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch doctor's consultancy charge"})
+		return
+	}
+
+	booking := models.Appointment{
+		PatientID:           entry.PatientID,
+		DoctorID:            entry.DoctorID,
+		PatientEmail:        entry.PatientEmail,
+		AppointmentDate:     entry.Date,
+		AppointmentTimeSlot: entry.OfferedTimeSlot,
+		PatientHealthIssue:  entry.PatientHealthIssue,
+	}
+
+	// Apply the booking policy for patients with repeated no-shows
+	prepaymentRequired, err := applyNoShowPolicy(entry.PatientID)
+	if errors.Is(err, errBookingBlocked) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Booking is blocked after repeated no-shows, please contact the hospital"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check booking policy"})
+		return
+	}
+
+	// Reserve the slot and create the invoice
+	invoice, err := reserveSlot(&booking, bookingInvoiceItems(doctor), "", prepaymentRequired, fmt.Sprintf("patient:%d", entry.PatientID))
+	if errors.Is(err, errSlotTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Offered slot is no longer available"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to book appointment"})
+		return
+	}
+
+	if err := configuration.DB.Model(&entry).Update("status", "claimed").Error; err != nil {
+		log.Println("Failed to mark waitlist entry as claimed:", err)
+	}
+
+	// Generate PDF invoice
+	pdfInvoice, err := generateDuePDFInvoice(booking, invoice, doctor, patient)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF invoice"})
+		return
+	}
+
+	// Send payment due email with PDF invoice attached
+	if err := SendEmail("Payment due invoice", booking.PatientEmail, "invoice.pdf", pdfInvoice); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Appointment booked successfully",
+		"Data":    booking,
+		"Invoice": invoice,
+	})
+}
+
+// offerFreedSlot offers a slot that became free to the first patient waiting for the
+// doctor's day, with a time-limited claim link
+func offerFreedSlot(doctorID int, date time.Time, timeSlot string) {
+	slotStart, err := slotStartTime(date, timeSlot)
+	if err != nil || slotStart.Before(time.Now()) {
+		return
+	}
+
+	// The first waiting patient gets the offer. Offers of a doctor are made under the same
+	// lock as bookings, so two slots freed at the same time can't offer overlapping slots,
+	// nor both go to the same patient.
+	var entry models.WaitlistEntry
+	offerToken := generateUniqueID()
+	offerExpiresAt := time.Now().Add(configuration.WaitlistClaimWindow())
+	err = configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("doctor_id").First(&models.Doctor{}, doctorID).Error; err != nil {
+			return err
+		}
+		taken, err := bookedTimeSlots(tx, doctorID, date, 0)
+		if err != nil {
+			return err
+		}
+		for offered := range offeredTimeSlots(tx, doctorID, date, 0) {
+			taken = append(taken, offered)
+		}
+		if overlapsAny(timeSlot, taken) {
+			return errSlotTaken
+		}
+
+		if err := tx.Where("doctor_id = ? AND date = ? AND status = ?", doctorID, date, "waiting").Order("created_at, id").First(&entry).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entry).Updates(map[string]interface{}{
+			"status":            "offered",
+			"offered_time_slot": timeSlot,
+			"offer_token":       offerToken,
+			"offer_expires_at":  offerExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, errSlotTaken) && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("Failed to offer slot to waitlisted patient:", err)
+		}
+		return
+	}
+
+	msg := fmt.Sprintf("A slot has opened up on %s at %s. Claim it before %s by sending this token to %s/waitlist/claim: %s",
+		date.Format("2006-01-02"), timeSlot, offerExpiresAt.Format("2006-01-02 15:04"), configuration.AppBaseURL(), offerToken)
+	if err := SendNotificationEmail("A slot is available for you", msg, entry.PatientEmail); err != nil {
+		log.Println("Failed to send waitlist offer email:", err)
+	}
+}
+
+// expireWaitlistOffer expires an unclaimed offer and moves the slot down the queue
+func expireWaitlistOffer(entry models.WaitlistEntry) {
+	if err := configuration.DB.Model(&entry).Where("status = ?", "offered").Update("status", "expired").Error; err != nil {
+		log.Println("Failed to expire waitlist offer:", err)
+		return
+	}
+	offerFreedSlot(entry.DoctorID, entry.Date, entry.OfferedTimeSlot)
+}
+
+// ExpireWaitlistOffers moves every unclaimed offer past its claim window to the next
+// waiting patient. It returns the number of offers expired.
+func ExpireWaitlistOffers() (int, error) {
+	var entries []models.WaitlistEntry
+	if err := configuration.DB.Where("status = ? AND offer_expires_at < ?", "offered", time.Now()).Find(&entries).Error; err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		expireWaitlistOffer(entry)
+	}
+	return len(entries), nil
+}
+
+// isSlotOfferedToOther checks if a slot overlaps a slot offered to a waitlisted patient other
+// than the given one
+func isSlotOfferedToOther(doctorID int, date time.Time, timeSlot string, patientID int) bool {
+	for offered := range offeredTimeSlots(configuration.DB, doctorID, date, patientID) {
+		if slotsOverlap(timeSlot, offered) {
+			return true
+		}
+	}
+	return false
+}
+
+// offeredTimeSlots returns the slots of a doctor's day held by live waitlist offers of
+// patients other than the given one
+func offeredTimeSlots(db *gorm.DB, doctorID int, date time.Time, patientID int) map[string]bool {
+	var entries []models.WaitlistEntry
+	if err := db.Where("doctor_id = ? AND date = ? AND status = ? AND offer_expires_at > ? AND patient_id <> ?", doctorID, date, "offered", time.Now(), patientID).Find(&entries).Error; err != nil {
+		log.Println("Failed to fetch waitlist offers:", err)
+	}
+	offered := make(map[string]bool)
+	for _, entry := range entries {
+		offered[entry.OfferedTimeSlot] = true
+	}
+	return offered
+}
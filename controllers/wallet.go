@@ -1,18 +1,29 @@
 package controllers
 
 import (
+	"doc-connect/access"
 	"doc-connect/configuration"
+	"doc-connect/ledger"
+	"doc-connect/lifecycle"
 	"doc-connect/models"
+	"doc-connect/money"
+	"doc-connect/refundpolicy"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GetUserWallet helps to get user wallet by user id
 func Wallet(c *gin.Context) {
 	userid := c.Param("userid")
+	if !authorized(c, access.PatientParam(principal(c), userid)) {
+		return
+	}
 
 	var wallet models.Wallet
 	if err := configuration.DB.Where("user_id = ?", userid).First(&wallet).Error; err != nil {
@@ -22,6 +33,7 @@ func Wallet(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"Status":        "Success",
 		"Wallet Amount": wallet.Amount,
+		"Currency":      wallet.Currency,
 	})
 
 }
@@ -117,91 +129,166 @@ func Wallet(c *gin.Context) {
 // 	}
 // }
 
-// CancelAppointment is a handler function for cancelling an appointment.
+// CancelAppointment is a handler function for cancelling an appointment. The refund is
+// decided by the refund rules and reported in the response. It is credited to the wallet
+// unless ?refund_to=source asks to refund an online payment to the card/UPI it was paid with.
 func CancelAppointment(c *gin.Context) {
-	var appointment models.Appointment
-	if err := configuration.DB.Where("appointment_id = ?", c.Param("id")).First(&appointment).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+	appointment, cancelledBy, ok := appointmentForCaller(c, c.Param("id"))
+	if !ok {
 		return
 	}
 
-	if appointment.BookingStatus == "cancelled" {
+	if appointment.BookingStatus == models.BookingCancelled {
 		c.JSON(http.StatusBadRequest, gin.H{"Error": "Appointment has already been cancelled"})
 		return
 	}
 
-	if appointment.BookingStatus == "completed" {
+	if appointment.BookingStatus == models.BookingCompleted {
 		c.JSON(http.StatusBadRequest, gin.H{"Error": "This appointment has already been completed"})
 		return
 	}
 
-	if appointment.BookingStatus != "confirmed" {
+	if appointment.BookingStatus != models.BookingConfirmed {
 		c.JSON(http.StatusBadRequest, gin.H{"Error": "Appointment cannot be cancelled as it is not confirmed"})
 		return
 	}
 
 	var invoice models.Invoice
-	if err := configuration.DB.Where("appointment_id = ?", c.Param("id")).First(&invoice).Error; err != nil {
+	if err := configuration.DB.Where("appointment_id = ?", appointment.AppointmentID).First(&invoice).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
 		return
 	}
 
-	if invoice.PaymentMethod == "online" {
-		// Refund applicable for online payments
-		refundAmount := invoice.TotalAmount * 0.95
-
-		// Update payment status to refunded
-		invoice.PaymentStatus = "refunded"
+	slotStart, err := slotStartTime(appointment.AppointmentDate, appointment.AppointmentTimeSlot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid time slot on appointment"})
+		return
+	}
 
-		// Update invoice in the database
-		if err := configuration.DB.Save(&invoice).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update invoice"})
+	// Only online payments can go back to where they came from
+	refundTo := c.DefaultQuery("refund_to", models.RefundToWallet)
+	var payment models.PaymentAttempt
+	switch refundTo {
+	case models.RefundToWallet:
+	case models.RefundToSource:
+		if invoice.PaymentMethod != "online" && invoice.PaymentMethod != models.PaymentMethodSplit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only online payments can be refunded to the original payment method"})
 			return
 		}
-
-		// Update wallet balance
-		var wallet models.Wallet
-		if err := configuration.DB.Where("user_id = ?", appointment.PatientID).First(&wallet).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch wallet"})
+		if payment, err = capturedPayment(invoice.InvoiceID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only online payments can be refunded to the original payment method"})
 			return
 		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refund_to must be wallet or source"})
+		return
+	}
 
-		// Add refund amount to wallet balance
-		wallet.Amount += refundAmount
+	actor := actorFromContext(c)
+
+	// Evaluate the refund policy, record the refund and cancel the appointment together
+	var decision refundpolicy.Decision
+	var refund *models.Refund
+	err = configuration.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		decision, err = refundpolicy.Evaluate(tx, refundpolicy.Cancellation{
+			CancelledBy:   cancelledBy,
+			PaymentMethod: invoice.PaymentMethod,
+			SlotStart:     slotStart,
+			CancelledAt:   time.Now(),
+			PaidAmount:    invoice.TotalAmount,
+		})
+		if err != nil {
+			return err
+		}
 
-		// Save updated wallet in the database
-		if err := configuration.DB.Where("user_id = ?", appointment.PatientID).Save(&wallet).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update wallet"})
-			return
+		change := lifecycle.Change{
+			To:     models.BookingCancelled,
+			Actor:  actor,
+			Reason: fmt.Sprintf("cancelled by %s, %s: no refund", cancelledBy, decision.RuleName),
 		}
 
-		appointment.BookingStatus = "cancelled"
-		if err := configuration.DB.Save(&appointment).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update appointment status"})
-			return
+		if decision.RefundAmount > 0 {
+			// Update payment status to refunded, the refund may be part of what was paid
+			if err := tx.Model(&invoice).Updates(map[string]interface{}{
+				"payment_status":  models.InvoiceRefunded,
+				"amount_refunded": decision.RefundAmount,
+			}).Error; err != nil {
+				return err
+			}
+
+			if refundTo == models.RefundToSource {
+				// The gateway refund is issued once the cancellation is saved. A split payment
+				// gets at most its online part back to source, the rest goes to the wallet.
+				toSource := decision.RefundAmount
+				if toSource > payment.Amount {
+					toSource = payment.Amount
+				}
+				refund = &models.Refund{
+					InvoiceID:         invoice.InvoiceID,
+					Provider:          payment.Provider,
+					ProviderPaymentID: payment.ProviderPaymentID,
+					Amount:            toSource,
+					Currency:          invoice.Currency,
+					Destination:       models.RefundToSource,
+					Status:            models.RefundPending,
+				}
+				if err := tx.Create(refund).Error; err != nil {
+					return err
+				}
+				if rest := decision.RefundAmount - toSource; rest > 0 {
+					if _, err := creditWalletRefund(tx, invoice, rest); err != nil {
+						return err
+					}
+				}
+			} else {
+				// Add refund amount to wallet balance
+				walletRefund, err := creditWalletRefund(tx, invoice, decision.RefundAmount)
+				if err != nil {
+					return err
+				}
+				refund = &walletRefund
+			}
+
+			change.PaymentStatus = models.AppointmentPaymentRefunded
+			change.Reason = fmt.Sprintf("cancelled by %s, %s: refunded %s to %s", cancelledBy, decision.RuleName, decision.RefundAmount, refundTo)
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": fmt.Sprintf("Appointment Cancelled. Refund amount: %.2f", refundAmount),
-		})
-	} else {
-		// For offline payments, simply cancel the appointment without refunding
-		appointment.BookingStatus = "cancelled"
+		return lifecycle.Transition(tx, &appointment, change)
+	})
+	if err != nil {
+		transitionError(c, err)
+		return
+	}
 
-		// Update appointment status in the database
-		if err := configuration.DB.Save(&appointment).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update appointment status"})
-			return
+	// Refund the original payment, the reconcile job retries if the gateway is unavailable
+	if refund != nil && refund.Destination == models.RefundToSource {
+		if err := issueGatewayRefund(refund); err != nil {
+			log.Println("Failed to issue gateway refund, will retry:", err)
 		}
+	}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Appointment Cancelled. Amount cannot be refunded as payment method was not online"})
+	// Offer the freed slot to the waitlist
+	offerFreedSlot(appointment.DoctorID, appointment.AppointmentDate, appointment.AppointmentTimeSlot)
+
+	message := "Appointment Cancelled. No refund applies"
+	if decision.RefundAmount > 0 {
+		message = fmt.Sprintf("Appointment Cancelled. Refund amount: %s", decision.RefundAmount)
 	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":       message,
+		"refund":        decision,
+		"refund_record": refund,
+	})
 }
 
+// PayFromWallet pays an invoice from the patient's wallet. With "partial": true a wallet that
+// doesn't cover the invoice pays what it holds, and the rest is paid online.
 func PayFromWallet(c *gin.Context) {
 	// Parse the JSON request body to extract the invoice ID
 	var paymentRequest struct {
 		InvoiceID uint `json:"invoice_id"`
+		Partial   bool `json:"partial"`
 	}
 
 	if err := c.BindJSON(&paymentRequest); err != nil {
@@ -211,17 +298,41 @@ func PayFromWallet(c *gin.Context) {
 
 	// Fetch the invoice from the database based on the provided invoice ID
 	var invoice models.Invoice
-	if err := configuration.DB.Where("invoice_id = ?", paymentRequest.InvoiceID).First(&invoice).Error; err != nil {
+	if err := configuration.DB.Preload("Items").Preload("Payments").Where("invoice_id = ?", paymentRequest.InvoiceID).First(&invoice).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
 		return
 	}
 
+	// Only the patient of the invoice can pay it from their wallet
+	if !authorized(c, access.Patient(principal(c), int(invoice.PatientID))) {
+		return
+	}
+
+	// A retried request is answered with the payment it already made
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		transaction, ok, err := ledger.FindByKey(configuration.DB, int(invoice.PatientID), walletPaymentKey(c, invoice))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet transactions"})
+			return
+		}
+		if ok {
+			c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Payment from wallet already processed", "data": transaction})
+			return
+		}
+	}
+
 	// Check if the invoice has already been paid
-	if invoice.PaymentStatus == "Paid" {
+	if invoice.PaymentStatus == models.InvoicePaid {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invoice already paid"})
 		return
 	}
 
+	// The slot is released once the payment window passes
+	if paymentWindowExpired(invoice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment window has expired, please book again"})
+		return
+	}
+
 	// Fetch the wallet details of the patient from the database
 	var wallet models.Wallet
 	if err := configuration.DB.Where("user_id = ?", invoice.PatientID).First(&wallet).Error; err != nil {
@@ -230,58 +341,45 @@ func PayFromWallet(c *gin.Context) {
 	}
 
 	// Check if the wallet balance is sufficient to pay the invoice
-	if wallet.Amount < invoice.TotalAmount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance in wallet"})
+	remaining, err := wallet.Balance().Sub(invoice.Outstanding())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wallet currency does not match the invoice"})
 		return
 	}
-
-	// Start a database transaction
-	tx := configuration.DB.Begin()
-
-	// Defer rollback if transaction fails
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Update invoice payment status
-	invoice.PaymentStatus = "Paid"
-	invoice.PaymentMethod = "online"
-	if err := tx.Save(&invoice).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status"})
+	if remaining.Amount < 0 && paymentRequest.Partial && wallet.Amount > 0 {
+		payPartlyFromWallet(c, invoice, wallet.Amount)
 		return
 	}
-
-	// Deduct payment amount from wallet balance
-	wallet.Amount -= invoice.TotalAmount
-	if err := tx.Model(&models.Wallet{}).Where("user_id = ?", wallet.UserID).Update("amount", wallet.Amount).Error; err != nil {
-		tx.Rollback()
-		log.Println("Failed to update wallet balance:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update wallet balance"})
+	if remaining.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance in wallet"})
 		return
 	}
 
-	// Update appointment status
+	// Debit the wallet, mark the invoice as paid and confirm the appointment together. The
+	// wallet stays locked until the payment is saved, so concurrent payments can't overdraw it.
+	outstanding := invoice.Outstanding()
 	var appointment models.Appointment
-	if err := tx.Where("appointment_id = ?", invoice.AppointmentID).First(&appointment).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointment"})
-		return
-	}
-
-	appointment.BookingStatus = "confirmed"
-	appointment.PaymentStatus = "paid"
-	if err := tx.Save(&appointment).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment status"})
+	err = configuration.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := ledger.Debit(tx, ledger.Entry{
+			UserID:         wallet.UserID,
+			Amount:         outstanding,
+			Reason:         models.WalletReasonInvoicePayment,
+			Description:    fmt.Sprintf("Payment of invoice %d", invoice.InvoiceID),
+			InvoiceID:      invoice.InvoiceID,
+			AppointmentID:  int(invoice.AppointmentID),
+			IdempotencyKey: walletPaymentKey(c, invoice),
+		}); err != nil {
+			return err
+		}
+		var err error
+		appointment, err = markInvoicePaid(tx, &invoice, "wallet", actorFromContext(c))
+		return err
+	})
+	if err != nil {
+		walletPaymentError(c, err)
 		return
 	}
 
-	// Commit the transaction
-	tx.Commit()
-
 	// Fetch doctor and patient details based on the booking
 	var doctor models.Doctor
 	if err := configuration.DB.First(&doctor, appointment.DoctorID).Error; err != nil {
@@ -311,3 +409,45 @@ func PayFromWallet(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Payment from wallet successful"})
 }
+
+// payPartlyFromWallet pays the wallet balance towards an invoice the wallet doesn't cover and
+// responds with the outstanding amount to pay online
+func payPartlyFromWallet(c *gin.Context, invoice models.Invoice, amount money.Amount) {
+	err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		return applyWalletPayment(tx, &invoice, amount, walletPaymentKey(c, invoice))
+	})
+	if err != nil {
+		walletPaymentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "success",
+		"message":      fmt.Sprintf("Paid %s from wallet, pay the outstanding %s online", amount, invoice.Outstanding()),
+		"invoice":      invoice,
+		"outstanding":  invoice.Outstanding(),
+		"checkout_url": fmt.Sprintf("/pay/invoice/online?id=%d", invoice.InvoiceID),
+	})
+}
+
+// walletPaymentKey is the idempotency key of a wallet payment towards an invoice: the
+// Idempotency-Key header of the request if sent, otherwise the key of the invoice's payment state
+func walletPaymentKey(c *gin.Context, invoice models.Invoice) string {
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		return fmt.Sprintf("client:%d:%s", invoice.PatientID, key)
+	}
+	return invoicePaymentKey(invoice)
+}
+
+// walletPaymentError responds with the error of a failed payment from the wallet
+func walletPaymentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ledger.ErrInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance in wallet"})
+	case errors.Is(err, ledger.ErrKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different payment"})
+	default:
+		log.Println("Failed to pay from wallet:", err)
+		transitionError(c, err)
+	}
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"bytes"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"gorm.io/gorm"
+)
+
+// WalletTransactions lists the ledger of the authenticated patient's wallet, newest first
+func WalletTransactions(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	patientID, _ := c.Get("patientID")
+	query := configuration.DB.Model(&models.WalletTransaction{}).Where("user_id = ?", patientID)
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet transactions"})
+		return
+	}
+
+	var transactions []models.WalletTransaction
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&transactions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":  "Success",
+		"Message": "Wallet transactions fetched successfully",
+		"data":    transactions,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
+
+// WalletStatement exports the wallet transactions of the authenticated patient between two dates
+// as a PDF statement. The period defaults to the last 30 days.
+func WalletStatement(c *gin.Context) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	var err error
+	if fromStr := c.Query("from"); fromStr != "" {
+		if from, err = time.Parse("2006-01-02", fromStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date format"})
+			return
+		}
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		if to, err = time.Parse("2006-01-02", toStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date format"})
+			return
+		}
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.Local)
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to date must not be before from date"})
+		return
+	}
+
+	patientID, _ := c.Get("patientID")
+	var patient models.Patient
+	if err := configuration.DB.First(&patient, patientID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+	var wallet models.Wallet
+	if err := configuration.DB.Where("user_id = ?", patientID).First(&wallet).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+		return
+	}
+
+	// The opening balance is the balance after the last transaction before the period
+	var opening models.WalletTransaction
+	err = configuration.DB.Where("user_id = ? AND currency = ? AND created_at < ?", patientID, wallet.Currency, from).
+		Order("id DESC").First(&opening).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet transactions"})
+		return
+	}
+
+	var transactions []models.WalletTransaction
+	if err := configuration.DB.Where("user_id = ? AND currency = ? AND created_at >= ? AND created_at < ?", patientID, wallet.Currency, from, to.AddDate(0, 0, 1)).
+		Order("id").Find(&transactions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet transactions"})
+		return
+	}
+
+	statement, err := generateWalletStatement(patient, wallet, money.New(opening.BalanceAfter, wallet.Currency), transactions, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate wallet statement"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=wallet-statement-%s-%s.pdf", from.Format("20060102"), to.Format("20060102")))
+	c.Data(http.StatusOK, "application/pdf", statement)
+}
+
+// generateWalletStatement renders the wallet transactions of a period as a PDF
+func generateWalletStatement(patient models.Patient, wallet models.Wallet, opening money.Money, transactions []models.WalletTransaction, from, to time.Time) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.AddPage()
+
+	pdf.SetFont("Arial", "B", 14)
+	pdf.SetTextColor(128, 0, 128) // Dark purple color
+	pdf.CellFormat(0, 10, "Go - Doctor Appointment Booking", "", 1, "C", false, 0, "")
+
+	pdf.SetFont("Arial", "B", 12)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.CellFormat(0, 10, "Wallet Statement", "1", 1, "C", false, 0, "")
+	add2Detail(pdf, "Patient Name", patient.Name, true)
+	add2Detail(pdf, "Period", from.Format("2006-01-02")+" to "+to.Format("2006-01-02"), true)
+	add2Detail(pdf, "Opening Balance", opening.String(), false)
+
+	pdf.SetFont("Arial", "B", 10)
+	pdf.CellFormat(35, 8, "Date", "1", 0, "", false, 0, "")
+	pdf.CellFormat(75, 8, "Description", "1", 0, "", false, 0, "")
+	pdf.CellFormat(27, 8, "Credit", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(27, 8, "Debit", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 8, "Balance", "1", 1, "R", false, 0, "")
+
+	pdf.SetFont("Arial", "", 10)
+	closing := opening.Amount
+	for _, transaction := range transactions {
+		credit, debit := "", ""
+		if transaction.Type == models.WalletDebit {
+			debit = transaction.Amount.String()
+		} else {
+			credit = transaction.Amount.String()
+		}
+		pdf.CellFormat(35, 8, transaction.CreatedAt.Format("2006-01-02 15:04"), "1", 0, "", false, 0, "")
+		pdf.CellFormat(75, 8, transaction.Description, "1", 0, "", false, 0, "")
+		pdf.CellFormat(27, 8, credit, "1", 0, "R", false, 0, "")
+		pdf.CellFormat(27, 8, debit, "1", 0, "R", false, 0, "")
+		pdf.CellFormat(0, 8, transaction.BalanceAfter.String(), "1", 1, "R", false, 0, "")
+		closing = transaction.BalanceAfter
+	}
+
+	pdf.SetFont("Arial", "B", 12)
+	add2Detail(pdf, "Closing Balance", money.New(closing, wallet.Currency).String(), true)
+
+	pdf.SetY(pdf.GetY() + 12)
+	pdf.CellFormat(0, 10, "This is a computer generated statement", "", 1, "R", false, 0, "")
+
+	var pdfBuffer bytes.Buffer
+	if err := pdf.Output(&pdfBuffer); err != nil {
+		return nil, err
+	}
+	return pdfBuffer.Bytes(), nil
+}
+
+// ReconcileWallets checks the balance of every wallet against the sum of its ledger and
+// reports the wallets that don't match
+func ReconcileWallets() (int, error) {
+	var mismatches []struct {
+		UserID   int
+		Currency string
+		Amount   money.Amount
+		Ledger   money.Amount
+	}
+	err := configuration.DB.Raw(`SELECT w.user_id, w.currency, w.amount,
+			COALESCE(SUM(CASE WHEN t.type = ? THEN -t.amount ELSE t.amount END), 0) AS ledger
+		FROM wallets w LEFT JOIN wallet_transactions t ON t.user_id = w.user_id AND t.currency = w.currency
+		GROUP BY w.user_id, w.currency, w.amount
+		HAVING w.amount <> COALESCE(SUM(CASE WHEN t.type = ? THEN -t.amount ELSE t.amount END), 0)`,
+		models.WalletDebit, models.WalletDebit).Scan(&mismatches).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for _, mismatch := range mismatches {
+		errs = append(errs, fmt.Errorf("wallet of user %d holds %s, its ledger sums to %s",
+			mismatch.UserID, money.New(mismatch.Amount, mismatch.Currency), money.New(mismatch.Ledger, mismatch.Currency)))
+	}
+	return len(mismatches), errors.Join(errs...)
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/ledger"
+	"doc-connect/models"
+	"doc-connect/money"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TopUpWallet creates a payment order to add money to the authenticated patient's wallet and
+// returns the checkout page to pay it on. The amount must be within the top-up limits and
+// must not take the wallet over its maximum balance.
+func TopUpWallet(c *gin.Context) {
+	var topUpRequest struct {
+		Amount money.Amount `json:"amount" binding:"gt=0"`
+	}
+	if err := c.BindJSON(&topUpRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	minimum, maximum := configuration.WalletTopUpMin(), configuration.WalletTopUpMax()
+	if topUpRequest.Amount < minimum || topUpRequest.Amount > maximum {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Top-up amount must be between %s and %s", minimum, maximum)})
+		return
+	}
+
+	patientID, _ := c.Get("patientID")
+	var wallet models.Wallet
+	if err := configuration.DB.Where("user_id = ?", patientID).First(&wallet).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+		return
+	}
+
+	// Top-ups that can still be paid count towards the balance. Abandoned checkouts stop
+	// counting once their checkout window has passed.
+	var open money.Amount
+	if err := configuration.DB.Model(&models.WalletTopUp{}).
+		Where("user_id = ? AND currency = ? AND status = ? AND created_at > ?",
+			wallet.UserID, wallet.Currency, models.WalletTopUpCreated, time.Now().Add(-configuration.WalletTopUpCheckoutWindow())).
+		Select("COALESCE(SUM(amount), 0)").Scan(&open).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet top-ups"})
+		return
+	}
+	if maxBalance := configuration.WalletMaxBalance(); wallet.Amount+open+topUpRequest.Amount > maxBalance {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Wallet balance can't exceed %s", maxBalance)})
+		return
+	}
+
+	provider := configuration.PaymentProvider
+	order, err := provider.CreateOrder(money.New(topUpRequest.Amount, wallet.Currency), fmt.Sprintf("wallet_%d", wallet.UserID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment order"})
+		return
+	}
+
+	topUp := models.WalletTopUp{
+		UserID:          wallet.UserID,
+		Provider:        provider.Name(),
+		ProviderOrderID: order.ID,
+		Amount:          order.Amount.Amount,
+		Currency:        order.Amount.Currency,
+		Status:          models.WalletTopUpCreated,
+	}
+	if err := configuration.DB.Create(&topUp).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create wallet top-up"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Status":       "Success",
+		"Message":      "Wallet top-up created, complete the payment at the checkout url",
+		"data":         topUp,
+		"checkout_url": "/wallet/topup/checkout?" + url.Values{"order_id": {order.ID}}.Encode(),
+	})
+}
+
+// TopUpCheckout renders the checkout page of an open wallet top-up
+func TopUpCheckout(c *gin.Context) {
+	var topUp models.WalletTopUp
+	if err := configuration.DB.Where("provider = ? AND provider_order_id = ?", configuration.PaymentProvider.Name(), c.Query("order_id")).
+		First(&topUp).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wallet top-up not found"})
+		return
+	}
+	if topUp.Status == models.WalletTopUpCredited {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wallet top-up is already paid"})
+		return
+	}
+	if topUp.Status == models.WalletTopUpFailed || topUp.Status == models.WalletTopUpRefunded || time.Since(topUp.CreatedAt) > configuration.WalletTopUpCheckoutWindow() {
+		c.JSON(http.StatusGone, gin.H{"error": "Wallet top-up has expired, please start a new one"})
+		return
+	}
+
+	var patient models.Patient
+	if err := configuration.DB.First(&patient, topUp.UserID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch patient details"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "topup.html", gin.H{
+		"orderID":     topUp.ProviderOrderID,
+		"totalPrice":  topUp.Amount,
+		"total":       topUp.Amount.Minor(),
+		"currency":    topUp.Currency,
+		"phonenumber": patient.Phone,
+		"provider":    topUp.Provider,
+	})
+}
+
+// TopUpSuccess credits the wallet once checkout reports a payment of a top-up order with a
+// valid provider signature
+func TopUpSuccess(c *gin.Context) {
+	orderID := c.Query("order_id")
+	paymentID := c.Query("payment_id")
+
+	// Only the provider can sign the order and payment with our key secret
+	provider := configuration.PaymentProvider
+	if orderID == "" || paymentID == "" || !provider.VerifyPayment(orderID, paymentID, c.Query("signature")) {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Payment verification failed"})
+		return
+	}
+
+	var topUp models.WalletTopUp
+	if err := configuration.DB.Where("provider = ? AND provider_order_id = ?", provider.Name(), orderID).First(&topUp).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"Error": "Wallet top-up not found"})
+		return
+	}
+
+	// The webhook may have credited the wallet already
+	var paid topUpPayment
+	if err := configuration.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		paid, err = creditWalletTopUp(tx, topUp, paymentID)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to credit the wallet"})
+		return
+	}
+
+	if refund := paid.Refund; refund != nil {
+		if refund.Status == models.RefundPending && refund.GatewayRefundID == "" {
+			if err := issueGatewayRefund(refund); err != nil {
+				log.Printf("Failed to issue refund %d, the reconcile job retries it: %v\n", refund.ID, err)
+			}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"Error": paid.Reason + ", the payment is refunded"})
+		return
+	}
+
+	var wallet models.Wallet
+	if err := configuration.DB.Where("user_id = ? AND currency = ?", topUp.UserID, topUp.Currency).First(&wallet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch wallet"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "success.html", gin.H{
+		"paymentID":     paymentID,
+		"amountPaid":    money.New(topUp.Amount, topUp.Currency),
+		"walletBalance": wallet.Balance(),
+	})
+}
+
+// topUpPayment is what became of a payment captured for a wallet top-up
+type topUpPayment struct {
+	Credited bool           // this call credited the wallet
+	Refund   *models.Refund // the payment couldn't be credited and is refunded
+	Reason   string         // why the payment is refunded
+}
+
+// creditWalletTopUp credits the amount of a paid top-up to the wallet. A top-up is credited
+// once, even if checkout and the webhook both report its payment. The checkout window and the
+// maximum balance are checked again under the wallet lock, a payment captured too late or that
+// would take the wallet over its maximum balance is refunded to source instead. A payment
+// retried in the same checkout after a failed one is credited like any other.
+func creditWalletTopUp(tx *gorm.DB, topUp models.WalletTopUp, paymentID string) (topUpPayment, error) {
+	var paid topUpPayment
+
+	// Top-ups of a wallet are credited one at a time, so together they can't exceed the maximum
+	var wallet models.Wallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND currency = ?", topUp.UserID, topUp.Currency).First(&wallet).Error; err != nil {
+		return paid, err
+	}
+	if err := tx.First(&topUp, topUp.ID).Error; err != nil {
+		return paid, err
+	}
+
+	switch topUp.Status {
+	case models.WalletTopUpCredited:
+		return paid, nil
+	case models.WalletTopUpRefunded:
+		var refund models.Refund
+		if err := tx.Where("wallet_top_up_id = ?", topUp.ID).First(&refund).Error; err != nil {
+			return paid, err
+		}
+		paid.Refund = &refund
+		paid.Reason = "Wallet top-up could not be credited"
+		return paid, nil
+	}
+
+	if time.Since(topUp.CreatedAt) > configuration.WalletTopUpCheckoutWindow() {
+		paid.Reason = "Wallet top-up has expired"
+	} else if maxBalance := configuration.WalletMaxBalance(); wallet.Amount+topUp.Amount > maxBalance {
+		paid.Reason = fmt.Sprintf("Wallet balance can't exceed %s", maxBalance)
+	}
+	if paid.Reason != "" {
+		if err := tx.Model(&topUp).Updates(map[string]interface{}{"provider_payment_id": paymentID, "status": models.WalletTopUpRefunded}).Error; err != nil {
+			return paid, err
+		}
+		refund := models.Refund{
+			WalletTopUpID:     topUp.ID,
+			Provider:          topUp.Provider,
+			ProviderPaymentID: paymentID,
+			Amount:            topUp.Amount,
+			Currency:          topUp.Currency,
+			Destination:       models.RefundToSource,
+			Status:            models.RefundPending,
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return paid, err
+		}
+		paid.Refund = &refund
+		return paid, nil
+	}
+
+	if err := tx.Model(&topUp).Updates(map[string]interface{}{"provider_payment_id": paymentID, "status": models.WalletTopUpCredited}).Error; err != nil {
+		return paid, err
+	}
+	if _, err := ledger.Credit(tx, ledger.Entry{
+		UserID:         topUp.UserID,
+		Amount:         money.New(topUp.Amount, topUp.Currency),
+		Reason:         models.WalletReasonTopUp,
+		Description:    fmt.Sprintf("Wallet top-up %d", topUp.ID),
+		IdempotencyKey: fmt.Sprintf("topup:%d", topUp.ID),
+	}); err != nil {
+		return paid, err
+	}
+	paid.Credited = true
+	return paid, nil
+}
+
+// topUpOfOrder returns the wallet top-up a provider order was created for
+func topUpOfOrder(tx *gorm.DB, provider, orderID string) (models.WalletTopUp, bool, error) {
+	var topUp models.WalletTopUp
+	err := tx.Where("provider = ? AND provider_order_id = ?", provider, orderID).First(&topUp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return topUp, false, nil
+	}
+	return topUp, err == nil, err
+}
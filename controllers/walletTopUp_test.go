@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"doc-connect/money"
+	"testing"
+	"time"
+)
+
+func TestCreditWalletTopUp(t *testing.T) {
+	useTestDB(t)
+
+	previous := configuration.Settings.Wallet
+	configuration.Settings.Wallet.MaxBalance = 100000
+	configuration.Settings.Wallet.CheckoutWindow = 30 * time.Minute
+	t.Cleanup(func() { configuration.Settings.Wallet = previous })
+
+	tests := []struct {
+		name       string
+		balance    money.Amount
+		age        time.Duration
+		wantStatus string
+	}{
+		{"within the limits", 0, time.Minute, models.WalletTopUpCredited},
+		{"paid after the checkout window", 0, time.Hour, models.WalletTopUpRefunded},
+		{"over the maximum balance", 80000, time.Minute, models.WalletTopUpRefunded},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := i + 1
+			if err := configuration.DB.Create(&models.Patient{PatientID: userID, Name: "Patient", Phone: "9999999999"}).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := configuration.DB.Create(&models.Wallet{UserID: userID, Amount: tt.balance, Currency: money.INR}).Error; err != nil {
+				t.Fatal(err)
+			}
+			topUp := models.WalletTopUp{
+				UserID:          userID,
+				Provider:        razorpayProvider,
+				ProviderOrderID: "order_topup_" + tt.name,
+				Amount:          50000,
+				Currency:        money.INR,
+				Status:          models.WalletTopUpCreated,
+				CreatedAt:       time.Now().Add(-tt.age),
+			}
+			if err := configuration.DB.Create(&topUp).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// Checkout and the webhook both report the payment
+			for report := 1; report <= 2; report++ {
+				if _, err := creditWalletTopUp(configuration.DB, topUp, "pay_topup"); err != nil {
+					t.Fatalf("report %d: creditWalletTopUp: %v", report, err)
+				}
+			}
+
+			var wallet models.Wallet
+			if err := configuration.DB.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := configuration.DB.First(&topUp, topUp.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if topUp.Status != tt.wantStatus {
+				t.Errorf("top-up is %s, want %s", topUp.Status, tt.wantStatus)
+			}
+			refunds := countRows(t, &models.Refund{}, "wallet_top_up_id = ?", topUp.ID)
+			if tt.wantStatus == models.WalletTopUpCredited {
+				if wallet.Amount != tt.balance+topUp.Amount || refunds != 0 {
+					t.Errorf("wallet holds %v with %d refunds, want %v credited once", wallet.Amount, refunds, tt.balance+topUp.Amount)
+				}
+				return
+			}
+			if wallet.Amount != tt.balance || refunds != 1 {
+				t.Errorf("wallet holds %v with %d refunds, want it untouched and one refund", wallet.Amount, refunds)
+			}
+		})
+	}
+}
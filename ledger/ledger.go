@@ -0,0 +1,110 @@
+package ledger
+
+import (
+	"doc-connect/models"
+	"doc-connect/money"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInsufficientBalance is returned when a wallet doesn't hold the amount to debit
+var ErrInsufficientBalance = errors.New("insufficient wallet balance")
+
+// ErrKeyReused is returned when an idempotency key was already used for a different change
+var ErrKeyReused = errors.New("idempotency key was used for a different wallet transaction")
+
+// Entry is a requested change of a wallet balance
+type Entry struct {
+	UserID        int
+	Amount        money.Money // positive, in the currency of the wallet
+	Reason        string
+	Description   string
+	InvoiceID     uint // 0 if not linked to an invoice
+	AppointmentID int  // 0 if not linked to an appointment
+	// IdempotencyKey identifies the change, a change retried with the same key is applied once
+	IdempotencyKey string
+}
+
+// Credit adds money to a wallet and records it in the ledger
+func Credit(tx *gorm.DB, entry Entry) (models.WalletTransaction, error) {
+	return post(tx, models.WalletCredit, entry)
+}
+
+// Debit takes money from a wallet and records it in the ledger. It fails with
+// ErrInsufficientBalance if the wallet doesn't hold the amount.
+func Debit(tx *gorm.DB, entry Entry) (models.WalletTransaction, error) {
+	return post(tx, models.WalletDebit, entry)
+}
+
+// FindByKey returns the transaction recorded for an idempotency key of a user
+func FindByKey(tx *gorm.DB, userID int, key string) (models.WalletTransaction, bool, error) {
+	var transaction models.WalletTransaction
+	err := tx.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&transaction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return transaction, false, nil
+	}
+	return transaction, err == nil, err
+}
+
+// post changes the balance of a wallet and appends the change to the ledger with the resulting
+// balance. The wallet row stays locked until the surrounding transaction ends, so concurrent
+// changes of a wallet are applied one after another. A change whose idempotency key was already
+// applied returns the recorded transaction without changing the balance again.
+func post(tx *gorm.DB, transactionType string, entry Entry) (models.WalletTransaction, error) {
+	transaction := models.WalletTransaction{
+		UserID:         entry.UserID,
+		Type:           transactionType,
+		Reason:         entry.Reason,
+		Description:    entry.Description,
+		InvoiceID:      entry.InvoiceID,
+		AppointmentID:  entry.AppointmentID,
+		Amount:         entry.Amount.Amount,
+		Currency:       entry.Amount.Currency,
+		IdempotencyKey: entry.IdempotencyKey,
+	}
+	if transaction.Amount <= 0 {
+		return transaction, fmt.Errorf("wallet transaction amount must be positive, got %s", transaction.Amount)
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		// Only a wallet of the transaction currency can be changed
+		var wallet models.Wallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND currency = ?", transaction.UserID, transaction.Currency).
+			First(&wallet).Error; err != nil {
+			return err
+		}
+
+		// Checked under the wallet lock, so a retry running concurrently waits for the first
+		if transaction.IdempotencyKey != "" {
+			applied, ok, err := FindByKey(tx, transaction.UserID, transaction.IdempotencyKey)
+			if err != nil {
+				return err
+			}
+			if ok {
+				if applied.Type != transaction.Type || applied.Amount != transaction.Amount || applied.Currency != transaction.Currency {
+					return fmt.Errorf("%w: %s", ErrKeyReused, transaction.IdempotencyKey)
+				}
+				transaction = applied
+				return nil
+			}
+		}
+
+		balance := wallet.Amount + transaction.Signed()
+		if balance < 0 {
+			return ErrInsufficientBalance
+		}
+		if err := tx.Model(&models.Wallet{}).
+			Where("user_id = ? AND currency = ?", transaction.UserID, transaction.Currency).
+			Update("amount", balance).Error; err != nil {
+			return err
+		}
+
+		transaction.BalanceAfter = balance
+		return tx.Create(&transaction).Error
+	})
+	return transaction, err
+}
@@ -0,0 +1,154 @@
+package lifecycle
+
+import (
+	"doc-connect/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrIllegalTransition is returned when an appointment can't move to the requested status
+var ErrIllegalTransition = errors.New("illegal appointment status transition")
+
+// ErrStaleAppointment is returned when the appointment was changed by someone else meanwhile
+var ErrStaleAppointment = errors.New("appointment was modified concurrently")
+
+// transitions lists the statuses an appointment can move to from each status.
+// Completed, cancelled and no-show appointments are final.
+var transitions = map[string][]string{
+	models.BookingPending:        {models.BookingConfirmed, models.BookingCancelled},
+	models.BookingConfirmed:      {models.BookingInConsultation, models.BookingCompleted, models.BookingCancelled, models.BookingNoShow},
+	models.BookingInConsultation: {models.BookingCompleted},
+}
+
+// Change is a requested status change of an appointment
+type Change struct {
+	To            string // booking status to move to
+	PaymentStatus string // payment status to set along with it, empty keeps the current one
+	Actor         string // patient:<id>, doctor:<id>, admin:<username> or system
+	Reason        string
+}
+
+// CanTransition reports whether an appointment can move from one booking status to another
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Created records the creation of a pending appointment in its transition history
+func Created(tx *gorm.DB, appointment *models.Appointment, actor string) error {
+	return tx.Create(&models.AppointmentTransition{
+		AppointmentID:   appointment.AppointmentID,
+		ToStatus:        appointment.BookingStatus,
+		ToPaymentStatus: appointment.PaymentStatus,
+		Actor:           actor,
+		Reason:          "booked",
+	}).Error
+}
+
+// Transition moves an appointment to a new status and records the transition. The update
+// only applies if the appointment still has the status it was read with.
+func Transition(tx *gorm.DB, appointment *models.Appointment, change Change) error {
+	from := appointment.BookingStatus
+	if !CanTransition(from, change.To) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, change.To)
+	}
+	if change.To == models.BookingNoShow && appointment.CheckedInAt != nil {
+		return fmt.Errorf("%w: patient has checked in", ErrIllegalTransition)
+	}
+
+	updates := map[string]interface{}{"booking_status": change.To}
+	paymentStatus := appointment.PaymentStatus
+	if change.PaymentStatus != "" {
+		paymentStatus = change.PaymentStatus
+		updates["payment_status"] = paymentStatus
+	}
+
+	result := tx.Model(&models.Appointment{}).
+		Where("appointment_id = ? AND booking_status = ?", appointment.AppointmentID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleAppointment
+	}
+
+	if err := tx.Create(&models.AppointmentTransition{
+		AppointmentID:     appointment.AppointmentID,
+		FromStatus:        from,
+		ToStatus:          change.To,
+		FromPaymentStatus: appointment.PaymentStatus,
+		ToPaymentStatus:   paymentStatus,
+		Actor:             change.Actor,
+		Reason:            change.Reason,
+	}).Error; err != nil {
+		return err
+	}
+
+	appointment.BookingStatus = change.To
+	appointment.PaymentStatus = paymentStatus
+	return nil
+}
+
+// CheckIn records the arrival of the patient of a confirmed appointment
+func CheckIn(tx *gorm.DB, appointment *models.Appointment, at time.Time, actor string) error {
+	if appointment.BookingStatus != models.BookingConfirmed {
+		return fmt.Errorf("%w: can't check in a %s appointment", ErrIllegalTransition, appointment.BookingStatus)
+	}
+
+	result := tx.Model(&models.Appointment{}).
+		Where("appointment_id = ? AND booking_status = ? AND checked_in_at IS NULL", appointment.AppointmentID, models.BookingConfirmed).
+		Update("checked_in_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleAppointment
+	}
+
+	if err := tx.Create(&models.AppointmentTransition{
+		AppointmentID:     appointment.AppointmentID,
+		FromStatus:        appointment.BookingStatus,
+		ToStatus:          appointment.BookingStatus,
+		FromPaymentStatus: appointment.PaymentStatus,
+		ToPaymentStatus:   appointment.PaymentStatus,
+		Actor:             actor,
+		Reason:            "checked in",
+	}).Error; err != nil {
+		return err
+	}
+
+	appointment.CheckedInAt = &at
+	return nil
+}
+
+// SetPaymentStatus changes only the payment status of an appointment, e.g. when a
+// cancelled appointment is refunded, and records it
+func SetPaymentStatus(tx *gorm.DB, appointment *models.Appointment, paymentStatus, actor, reason string) error {
+	if err := tx.Model(&models.Appointment{}).Where("appointment_id = ?", appointment.AppointmentID).
+		Update("payment_status", paymentStatus).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Create(&models.AppointmentTransition{
+		AppointmentID:     appointment.AppointmentID,
+		FromStatus:        appointment.BookingStatus,
+		ToStatus:          appointment.BookingStatus,
+		FromPaymentStatus: appointment.PaymentStatus,
+		ToPaymentStatus:   paymentStatus,
+		Actor:             actor,
+		Reason:            reason,
+	}).Error; err != nil {
+		return err
+	}
+
+	appointment.PaymentStatus = paymentStatus
+	return nil
+}
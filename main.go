@@ -1,23 +1,66 @@
 package main
 
 import (
+	"fmt"
+	"log"
+
 	"doc-connect/configuration"
+	"doc-connect/controllers"
 	"doc-connect/routes"
+	"doc-connect/scheduler"
 )
 
 func Init() {
+	if err := configuration.Load(); err != nil {
+		log.Fatal(err)
+	}
 	configuration.ConfigDB()
 	configuration.InitRedis()
+	configuration.InitPayments()
+}
+
+// StartJobs starts the background jobs of the server
+func StartJobs() {
+	scheduler.Start(
+		scheduler.Job{
+			Name:     "expire-overdue-invoices",
+			Interval: configuration.InvoiceExpiryInterval(),
+			Run:      controllers.ExpireOverdueInvoices,
+		},
+		scheduler.Job{
+			Name:     "expire-waitlist-offers",
+			Interval: configuration.WaitlistOfferInterval(),
+			Run:      controllers.ExpireWaitlistOffers,
+		},
+		scheduler.Job{
+			Name:     "reconcile-refunds",
+			Interval: configuration.RefundReconcileInterval(),
+			Run:      controllers.ReconcileRefunds,
+		},
+		scheduler.Job{
+			Name:     "reconcile-wallets",
+			Interval: configuration.WalletReconcileInterval(),
+			Run:      controllers.ReconcileWallets,
+		},
+		scheduler.Job{
+			Name:     "generate-payout-statements",
+			Interval: configuration.PayoutStatementInterval(),
+			Run:      controllers.GeneratePayoutStatements,
+		},
+	)
 }
 
 func main() {
 	//Perform application initialization
 	Init()
+	if configuration.Settings.Features.Jobs {
+		StartJobs()
+	}
 	r := routes.UserRoutes()
 	r.LoadHTMLGlob("templates/*")
 
 	//Run the engine in default port
-	if err := r.Run(); err != nil {
+	if err := r.Run(fmt.Sprintf(":%d", configuration.Settings.Server.Port)); err != nil {
 		panic(err)
 	}
 
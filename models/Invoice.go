@@ -1,23 +1,40 @@
 package models
 
-import "time"
+import (
+	"doc-connect/money"
+	"time"
+)
 
 type Invoice struct {
-	InvoiceID      uint      `gorm:"primaryKey"`
-	DoctorID       uint      `gorm:"not null"`
-	PatientID      uint      `gorm:"not null"`
-	AppointmentID  uint      `gorm:"not null"`
-	TotalAmount    float64    `gorm:"not null"`
-	PaymentMethod  string    `json:"payment_method"`
-	PaymentStatus  string    `gorm:"not null"`
-	PaymentDueDate time.Time `gorm:"not null"`
-	CreatedAt      time.Time `gorm:"autoCreateTime"`
-	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+	InvoiceID          uint             `gorm:"primaryKey"`
+	DoctorID           uint             `gorm:"not null"`
+	PatientID          uint             `gorm:"not null"`
+	AppointmentID      uint             `gorm:"not null"`
+	TotalAmount        money.Amount     `gorm:"not null"`
+	AmountPaid         money.Amount     `json:"amount_paid" gorm:"not null;default:0"`
+	AmountRefunded     money.Amount     `json:"amount_refunded" gorm:"not null;default:0"` // given back when the appointment was cancelled
+	Currency           string           `json:"currency" gorm:"not null;default:INR"`
+	PaymentMethod      string           `json:"payment_method"`
+	PaymentStatus      string           `gorm:"not null"`
+	PaymentDueDate     time.Time        `gorm:"not null"`
+	PrepaymentRequired bool             `json:"prepayment_required"` // can't be paid offline
+	Subtotal           money.Amount     `json:"subtotal"`            // line items before discount and tax
+	DiscountAmount     money.Amount     `json:"discount_amount"`
+	TaxAmount          money.Amount     `json:"tax_amount"`
+	RoundingAdjustment money.Amount     `json:"rounding_adjustment"` // added to round the total
+	CouponCode         string           `json:"coupon_code"`
+	Items              []InvoiceItem    `json:"items" gorm:"foreignKey:InvoiceID;references:InvoiceID"`
+	Payments           []InvoicePayment `json:"payments" gorm:"foreignKey:InvoiceID;references:InvoiceID"`
+	CreatedAt          time.Time        `gorm:"autoCreateTime"`
+	UpdatedAt          time.Time        `gorm:"autoUpdateTime"`
 }
 
-type RazorPay struct {
-	RazorPaymentID  string `json:"razorpaymentID" gorm:"primaryKey;autoIncrement"`
-	RazorPayorderID string `json:"razorpayorderID"`
-	InvoiceID       uint   `json:"invoice_id"`
-	AmountPaid      float64 `json:"amount_paid"`
+// Total is the amount to be paid for the invoice
+func (invoice Invoice) Total() money.Money {
+	return money.New(invoice.TotalAmount, invoice.Currency)
+}
+
+// Outstanding is the amount of the invoice that is still to be paid
+func (invoice Invoice) Outstanding() money.Money {
+	return money.New(invoice.TotalAmount-invoice.AmountPaid, invoice.Currency)
 }
@@ -1,14 +1,31 @@
 package models
 
-import "github.com/dgrijalva/jwt-go"
+import "time"
+
+// Roles of admins, deciding what they can administer
+const (
+	AdminRoleSuperAdmin = "super_admin"
+	AdminRoleFinance    = "finance"
+	AdminRoleVerifier   = "verifier"
+	AdminRoleSupport    = "support"
+)
+
+// Statuses of admin accounts
+const (
+	AdminInvited  = "invited" // until the invited admin sets a password
+	AdminActive   = "active"
+	AdminDisabled = "disabled"
+)
 
 type Admin struct {
-	AdminID  int    `gorm:"primaryKey"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	AdminID                int        `gorm:"primaryKey" json:"admin_id"`
+	Username               string     `json:"username" gorm:"uniqueIndex"`
+	Email                  string     `json:"email"`
+	Password               string     `json:"-"`
+	Role                   string     `json:"role" gorm:"not null;default:super_admin"` // admins from before roles administer everything
+	Status                 string     `json:"status" gorm:"not null;default:active"`
+	PasswordTokenHash      string     `json:"-"` // of the invite or reset link to set a password with
+	PasswordTokenExpiresAt *time.Time `json:"-"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
 }
-
-type AdminClaims struct {
-	Username string `json:"username"`
-	jwt.StandardClaims
-}
\ No newline at end of file
@@ -3,13 +3,27 @@ package models
 import "time"
 
 type Appointment struct {
-	AppointmentID       int       `gorm:"primaryKey"`
-	PatientID           int       `json:"patient_id"`
-	DoctorID            int       `json:"doctor_id"`
-	PatientEmail        string    `json:"email"`
-	AppointmentDate     time.Time `json:"appointment_date"`
-	AppointmentTimeSlot string    `json:"appointment_time"`
-	PatientHealthIssue  string    `json:"patient_health_issue"`
-	PaymentStatus       string    `json:"payment_status"`
-	BookingStatus       string    `json:"booking_status"`
+	AppointmentID       int        `gorm:"primaryKey"`
+	PatientID           int        `json:"patient_id"`
+	DoctorID            int        `json:"doctor_id"`
+	PatientEmail        string     `json:"email"`
+	AppointmentDate     time.Time  `json:"appointment_date"`
+	AppointmentTimeSlot string     `json:"appointment_time"`
+	PatientHealthIssue  string     `json:"patient_health_issue"`
+	PaymentStatus       string     `json:"payment_status"`
+	BookingStatus       string     `json:"booking_status"`
+	HoldExpiresAt       *time.Time `json:"hold_expires_at"` // pending booking holds the slot until then
+	CheckedInAt         *time.Time `json:"checked_in_at"`   // arrival of the patient
+}
+
+// AppointmentReschedule keeps the previous slot of a rescheduled appointment
+type AppointmentReschedule struct {
+	ID               uint      `gorm:"primaryKey"`
+	AppointmentID    int       `json:"appointment_id" gorm:"not null;index"`
+	PreviousDate     time.Time `json:"previous_date"`
+	PreviousTimeSlot string    `json:"previous_time_slot"`
+	NewDate          time.Time `json:"new_date"`
+	NewTimeSlot      string    `json:"new_time_slot"`
+	RescheduledBy    string    `json:"rescheduled_by"` // patient or doctor
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
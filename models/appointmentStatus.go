@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Booking statuses of an appointment
+const (
+	BookingPending        = "pending"
+	BookingConfirmed      = "confirmed"
+	BookingInConsultation = "in-consultation"
+	BookingCompleted      = "completed"
+	BookingCancelled      = "cancelled"
+	BookingNoShow         = "no-show"
+)
+
+// Payment statuses of an appointment
+const (
+	AppointmentPaymentPending  = "pending"
+	AppointmentPaymentPaid     = "paid"
+	AppointmentPaymentExpired  = "expired"
+	AppointmentPaymentRefunded = "refunded"
+)
+
+// Payment statuses of an invoice
+const (
+	InvoicePending       = "Pending"
+	InvoicePartiallyPaid = "PartiallyPaid" // part paid from the wallet, the rest is outstanding
+	InvoicePaid          = "Paid"
+	InvoiceExpired       = "Expired"
+	InvoiceRefunded      = "Refunded"
+)
+
+// AppointmentTransition records who moved an appointment from one status to another and when
+type AppointmentTransition struct {
+	ID                uint      `gorm:"primaryKey"`
+	AppointmentID     int       `json:"appointment_id" gorm:"not null;index"`
+	FromStatus        string    `json:"from_status"`
+	ToStatus          string    `json:"to_status" gorm:"not null"`
+	FromPaymentStatus string    `json:"from_payment_status"`
+	ToPaymentStatus   string    `json:"to_payment_status"`
+	Actor             string    `json:"actor" gorm:"not null"` // patient:<id>, doctor:<id>, admin:<username> or system
+	Reason            string    `json:"reason"`
+	CreatedAt         time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
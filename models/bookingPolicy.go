@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Actions taken on bookings of a patient who reached the no-show threshold
+const (
+	NoShowActionPrepay = "prepay" // the invoice has to be paid online or from the wallet
+	NoShowActionBlock  = "block"  // the patient can't book
+)
+
+// BookingPolicy decides how patients with repeated no-shows can book. There is a single policy.
+type BookingPolicy struct {
+	ID              uint      `gorm:"primaryKey"`
+	NoShowThreshold int       `json:"no_show_threshold"` // 0 disables the policy
+	NoShowAction    string    `json:"no_show_action"`
+	UpdatedBy       string    `json:"updated_by"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Discount types of a coupon
+const (
+	CouponPercent = "percent"
+	CouponFlat    = "flat"
+)
+
+// Coupon is a promo code giving a discount on the consultation fee of an invoice.
+// Zero values of the restrictions and caps mean no restriction.
+type Coupon struct {
+	ID                    uint         `gorm:"primaryKey"`
+	Code                  string       `json:"code" gorm:"not null;uniqueIndex"`
+	Description           string       `json:"description"`
+	DiscountType          string       `json:"discount_type" gorm:"not null"` // percent or flat
+	PercentOff            float64      `json:"percent_off"`
+	AmountOff             money.Amount `json:"amount_off"`
+	MaxDiscount           money.Amount `json:"max_discount"` // caps a percent discount
+	ValidFrom             *time.Time   `json:"valid_from"`
+	ValidUntil            *time.Time   `json:"valid_until"`
+	MaxRedemptions        int          `json:"max_redemptions"` // over all patients
+	MaxPerPatient         int          `json:"max_per_patient"`
+	FirstConsultationOnly bool         `json:"first_consultation_only"`
+	Specialization        string       `json:"specialization"`
+	HospitalID            uint         `json:"hospital_id"`
+	DoctorID              uint         `json:"doctor_id"`
+	Active                bool         `json:"active"`
+	CreatedAt             time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt             time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// CouponRedemption is the use of a coupon on an invoice
+type CouponRedemption struct {
+	ID        uint         `gorm:"primaryKey"`
+	CouponID  uint         `json:"coupon_id" gorm:"not null;index"`
+	PatientID uint         `json:"patient_id" gorm:"not null;index"`
+	InvoiceID uint         `json:"invoice_id" gorm:"not null;uniqueIndex"`
+	Discount  money.Amount `json:"discount"`
+	CreatedAt time.Time    `json:"created_at" gorm:"autoCreateTime"`
+}
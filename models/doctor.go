@@ -1,7 +1,5 @@
 package models
 
-import "github.com/golang-jwt/jwt/v5"
-
 type Doctor struct {
 	DoctorID          uint   `gorm:"primaryKey"`
 	Name              string `json:"name" gorm:"not null"`
@@ -19,9 +17,3 @@ type Doctor struct {
 	HospitalID        uint   `json:"hospital_id" gorm:"not null"`
 	Availabilities    []DoctorAvailability
 }
-
-type DoctorClaims struct {
-	Id          uint   `json:"id"`
-	DoctorEmail string `json:"email"`
-	jwt.RegisteredClaims
-}
@@ -2,9 +2,43 @@ package models
 
 import "time"
 
+// DoctorAvailability is the availability of a doctor on one specific date.
+// It overrides the weekly schedule for that date.
 type DoctorAvailability struct {
-	ID           uint      `gorm:"primaryKey"`
-	DoctorID     uint      `json:"doctor_id"`
-	Date         time.Time `json:"date"`
-	AvilableTime string    `json:"available_time"`
+	ID           uint                 `gorm:"primaryKey"`
+	DoctorID     uint                 `json:"doctor_id"`
+	Date         time.Time            `json:"date"`
+	AvilableTime string               `json:"available_time"` // legacy single "HH:MM-HH:MM" window
+	Windows      []AvailabilityWindow `json:"windows" gorm:"foreignKey:DoctorAvailabilityID"`
+}
+
+// DoctorWeeklySchedule is a recurring availability template for one weekday
+type DoctorWeeklySchedule struct {
+	ID             uint                 `gorm:"primaryKey"`
+	DoctorID       uint                 `json:"doctor_id" gorm:"not null;index"`
+	Weekday        int                  `json:"weekday" gorm:"not null"` // 0 = Sunday ... 6 = Saturday
+	AvailableTime  string               `json:"available_time"`          // legacy single "HH:MM-HH:MM" window
+	EffectiveFrom  time.Time            `json:"effective_from" gorm:"not null"`
+	EffectiveUntil *time.Time           `json:"effective_until"`
+	Windows        []AvailabilityWindow `json:"windows" gorm:"foreignKey:WeeklyScheduleID"`
+}
+
+// AvailabilityWindow is one working window of a day (morning OPD, evening clinic).
+// It is split into slots of SlotMinutes with BufferMinutes between consecutive slots.
+type AvailabilityWindow struct {
+	ID                   uint   `gorm:"primaryKey"`
+	DoctorAvailabilityID *uint  `json:"-" gorm:"index"`
+	WeeklyScheduleID     *uint  `json:"-" gorm:"index"`
+	StartTime            string `json:"start_time" gorm:"not null"`
+	EndTime              string `json:"end_time" gorm:"not null"`
+	SlotMinutes          int    `json:"slot_minutes" gorm:"not null"`
+	BufferMinutes        int    `json:"buffer_minutes"`
+}
+
+// DoctorBlackout marks a date on which the doctor is not available at all (holiday, leave)
+type DoctorBlackout struct {
+	ID       uint      `gorm:"primaryKey"`
+	DoctorID uint      `json:"doctor_id" gorm:"not null;index"`
+	Date     time.Time `json:"date" gorm:"not null"`
+	Reason   string    `json:"reason"`
 }
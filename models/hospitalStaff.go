@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Statuses of hospital staff accounts
+const (
+	StaffInvited  = "invited" // until the invited staff member sets a password
+	StaffActive   = "active"
+	StaffDisabled = "disabled"
+)
+
+// HospitalStaff is a front desk account of a hospital. Staff act for the doctors of their
+// hospital only.
+type HospitalStaff struct {
+	StaffID                uint       `gorm:"primaryKey" json:"staff_id"`
+	HospitalID             uint       `json:"hospital_id" gorm:"not null;index"`
+	Name                   string     `json:"name"`
+	Email                  string     `json:"email" gorm:"uniqueIndex"`
+	Password               string     `json:"-"`
+	Status                 string     `json:"status" gorm:"not null;default:invited"`
+	PasswordTokenHash      string     `json:"-"` // of the invite or reset link to set a password with
+	PasswordTokenExpiresAt *time.Time `json:"-"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+}
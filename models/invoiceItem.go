@@ -0,0 +1,29 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Kinds of invoice line items
+const (
+	InvoiceItemConsultation = "consultation"
+	InvoiceItemPlatformFee  = "platform_fee"
+	InvoiceItemLabTest      = "lab_test"
+	InvoiceItemProcedure    = "procedure"
+)
+
+// InvoiceItem is a line of an invoice. The discount is taken off before tax.
+type InvoiceItem struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint         `json:"invoice_id" gorm:"not null;index"`
+	Kind        string       `json:"kind" gorm:"not null"`
+	Description string       `json:"description"`
+	Quantity    int          `json:"quantity" gorm:"not null;default:1"`
+	UnitPrice   money.Amount `json:"unit_price" gorm:"not null"`
+	Discount    money.Amount `json:"discount"`
+	TaxRate     float64      `json:"tax_rate"` // GST in percent, split equally into CGST and SGST
+	TaxAmount   money.Amount `json:"tax_amount"`
+	Amount      money.Amount `json:"amount"` // after discount, including tax
+	CreatedAt   time.Time    `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Statuses of an invoice payment
+const (
+	InvoicePaymentApplied  = "applied"
+	InvoicePaymentReversed = "reversed" // given back because the rest of the invoice wasn't paid
+)
+
+// PaymentMethodSplit is the payment method of an invoice paid partly from the wallet and
+// partly with another method
+const PaymentMethodSplit = "split"
+
+// InvoicePayment is money applied to an invoice. An invoice can be paid in several parts,
+// e.g. from the wallet and the rest online.
+type InvoicePayment struct {
+	ID        uint         `gorm:"primaryKey"`
+	InvoiceID uint         `json:"invoice_id" gorm:"not null;index"`
+	Method    string       `json:"method" gorm:"not null"` // wallet, online or Offline
+	Amount    money.Amount `json:"amount" gorm:"not null"`
+	Currency  string       `json:"currency" gorm:"not null;default:INR"`
+	Status    string       `json:"status" gorm:"not null"`
+	CreatedAt time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// JobRun records one run of a background job
+type JobRun struct {
+	ID         uint       `gorm:"primaryKey"`
+	JobName    string     `json:"job_name" gorm:"not null;index"`
+	StartedAt  time.Time  `json:"started_at" gorm:"not null"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Processed  int        `json:"processed"`
+	Status     string     `json:"status" gorm:"not null"` // running, success or failed
+	Error      string     `json:"error"`
+}
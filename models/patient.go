@@ -1,7 +1,5 @@
 package models
 
-import "github.com/dgrijalva/jwt-go"
-
 type Patient struct {
 	PatientID int    `gorm:"primaryKey"`
 	Name      string `json:"name"`
@@ -17,9 +15,3 @@ type VerifyOTP struct {
 	Phone string `json:"phone"`
 	Otp   string `json:"otp"`
 }
-
-type PatientClaims struct {
-	jwt.StandardClaims
-	PatientID int `json:"patientID"`
-	Phone string `json:"phone"`
-}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Statuses of a payment attempt
+const (
+	PaymentAttemptCreated  = "created"
+	PaymentAttemptCaptured = "captured"
+	PaymentAttemptFailed   = "failed"
+)
+
+// PaymentAttempt is an order created with a payment provider to pay an invoice online
+type PaymentAttempt struct {
+	ID                uint         `gorm:"primaryKey"`
+	InvoiceID         uint         `json:"invoice_id" gorm:"not null;index"`
+	Provider          string       `json:"provider" gorm:"not null;uniqueIndex:idx_payment_attempts_order"`
+	ProviderOrderID   string       `json:"provider_order_id" gorm:"not null;uniqueIndex:idx_payment_attempts_order"`
+	ProviderPaymentID string       `json:"provider_payment_id"` // set once the customer paid or failed to pay
+	Amount            money.Amount `json:"amount"`
+	Currency          string       `json:"currency"`
+	Status            string       `json:"status" gorm:"not null"`
+	CreatedAt         time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
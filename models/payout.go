@@ -0,0 +1,64 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Statuses of a payout
+const (
+	PayoutPending = "pending" // statement generated, not transferred yet
+	PayoutOnHold  = "on_hold"
+	PayoutPaid    = "paid"
+)
+
+// Kinds of payout items
+const (
+	PayoutItemSettlement       = "settlement"
+	PayoutItemRefundAdjustment = "refund_adjustment" // takes back an invoice refunded after a payout settled it
+)
+
+// Commission is the share of a doctor's earnings the platform keeps, set for one doctor or
+// for every doctor of a hospital. A doctor's own commission wins over the hospital's.
+type Commission struct {
+	ID         uint      `gorm:"primaryKey"`
+	DoctorID   uint      `json:"doctor_id" gorm:"uniqueIndex:idx_commissions_owner"`   // 0 for a hospital commission
+	HospitalID uint      `json:"hospital_id" gorm:"uniqueIndex:idx_commissions_owner"` // 0 for a doctor commission
+	Percent    float64   `json:"percent" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Payout is the statement of what the platform owes a doctor for the paid invoices up to the
+// end of a period, and whether it was transferred
+type Payout struct {
+	ID          uint         `gorm:"primaryKey"`
+	DoctorID    uint         `json:"doctor_id" gorm:"not null;uniqueIndex:idx_payouts_period"`
+	PeriodStart time.Time    `json:"period_start" gorm:"not null;uniqueIndex:idx_payouts_period"`
+	PeriodEnd   time.Time    `json:"period_end" gorm:"not null"` // exclusive
+	Currency    string       `json:"currency" gorm:"not null;default:INR;uniqueIndex:idx_payouts_period"`
+	Earnings    money.Amount `json:"earnings"` // doctor's share of the invoices before commission
+	Commission  money.Amount `json:"commission"`
+	NetAmount   money.Amount `json:"net_amount"` // owed to the doctor
+	Status      string       `json:"status" gorm:"not null;index"`
+	Reference   string       `json:"reference"` // bank transfer reference once paid
+	PaidAt      *time.Time   `json:"paid_at"`
+	Items       []PayoutItem `json:"items,omitempty"`
+	CreatedAt   time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// PayoutItem is an invoice settled by a payout, or the negative adjustment taking it back
+// when it was refunded afterwards. An invoice is settled and adjusted at most once.
+type PayoutItem struct {
+	ID                uint         `gorm:"primaryKey"`
+	PayoutID          uint         `json:"payout_id" gorm:"not null;index"`
+	InvoiceID         uint         `json:"invoice_id" gorm:"not null;uniqueIndex:idx_payout_items_invoice_kind"`
+	Kind              string       `json:"kind" gorm:"not null;default:settlement;uniqueIndex:idx_payout_items_invoice_kind"`
+	AppointmentID     uint         `json:"appointment_id"`
+	AppointmentDate   time.Time    `json:"appointment_date"`
+	Earnings          money.Amount `json:"earnings"`
+	CommissionPercent float64      `json:"commission_percent"`
+	Commission        money.Amount `json:"commission"`
+	NetAmount         money.Amount `json:"net_amount"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Statuses of a refund
+const (
+	RefundPending   = "pending"
+	RefundProcessed = "processed"
+	RefundFailed    = "failed"
+)
+
+// Destinations of a refund
+const (
+	RefundToWallet = "wallet"
+	RefundToSource = "source" // the card/UPI the invoice was paid with online
+)
+
+// Refund is money given back for a cancelled appointment, or for a wallet top-up that couldn't
+// be credited
+type Refund struct {
+	ID                uint         `gorm:"primaryKey"`
+	InvoiceID         uint         `json:"invoice_id" gorm:"not null;index"` // 0 for a wallet top-up refund
+	WalletTopUpID     uint         `json:"wallet_top_up_id,omitempty" gorm:"index"`
+	Provider          string       `json:"provider"`            // payment provider of a refund to source
+	ProviderPaymentID string       `json:"provider_payment_id"` // refunded payment, empty for wallet refunds
+	Amount            money.Amount `json:"amount" gorm:"not null"`
+	Currency          string       `json:"currency" gorm:"not null;default:INR"`
+	Destination       string       `json:"destination" gorm:"not null"`
+	Status            string       `json:"status" gorm:"not null;index"`
+	GatewayRefundID   string       `json:"gateway_refund_id"`
+	Attempts          int          `json:"attempts"`
+	FailureReason     string       `json:"failure_reason"`
+	CreatedAt         time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Values of a refund rule that match every cancellation
+const (
+	RefundRuleAnyCanceller = "any"
+	RefundRuleAnyMethod    = "any"
+)
+
+// RefundRule is a tier of the cancellation policy. The active rule with the lowest priority
+// that matches a cancellation decides which share of the invoice is refunded.
+type RefundRule struct {
+	ID             uint      `gorm:"primaryKey"`
+	Name           string    `json:"name" gorm:"not null"`
+	CancelledBy    string    `json:"cancelled_by" gorm:"not null"`   // patient, doctor or any
+	PaymentMethod  string    `json:"payment_method" gorm:"not null"` // online, wallet, Offline or any
+	MinHoursBefore int       `json:"min_hours_before"`               // cancelled at least this long before the slot
+	RefundPercent  float64   `json:"refund_percent"`
+	Priority       int       `json:"priority"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
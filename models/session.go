@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Kinds of users that sign in
+const (
+	RolePatient       = "patient"
+	RoleDoctor        = "doctor"
+	RoleHospitalStaff = "hospital_staff"
+	RoleAdmin         = "admin"
+	RoleSuperAdmin    = "super_admin"
+)
+
+// AuthClaims are the claims of an access token. The subject is the patient id, doctor id, staff
+// id or admin username depending on the role.
+type AuthClaims struct {
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	Name      string `json:"name"` // phone of a patient, email of a doctor or staff, username of an admin
+	jwt.RegisteredClaims
+}
+
+// Session is a sign in of a user on a device, kept in redis until it expires or is revoked.
+// Access tokens are only accepted while their session exists.
+type Session struct {
+	ID          string    `json:"id"`
+	Role        string    `json:"role"`
+	Subject     string    `json:"subject"`
+	Name        string    `json:"name"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	CreatedAt   time.Time `json:"created_at"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	RefreshHash string    `json:"refresh_hash,omitempty"` // of the only refresh token that can still be used
+	Current     bool      `json:"current,omitempty"`      // set when listing, for the session asking
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// WaitlistEntry queues a patient for a fully booked day of a doctor. When a slot frees up
+// the first waiting patient is offered it for a limited time.
+type WaitlistEntry struct {
+	ID                 uint       `gorm:"primaryKey"`
+	PatientID          int        `json:"patient_id" gorm:"not null;index"`
+	DoctorID           int        `json:"doctor_id" gorm:"not null;index"`
+	Date               time.Time  `json:"date" gorm:"not null"`
+	PatientEmail       string     `json:"email"`
+	PatientHealthIssue string     `json:"patient_health_issue"`
+	Status             string     `json:"status" gorm:"not null"` // waiting, offered, claimed, expired or cancelled
+	OfferedTimeSlot    string     `json:"offered_time_slot"`
+	OfferToken         string     `json:"-" gorm:"index"`
+	OfferExpiresAt     *time.Time `json:"offer_expires_at"`
+	CreatedAt          time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -1,7 +1,15 @@
 package models
 
+import "doc-connect/money"
+
 type Wallet struct {
-	UserID int `json:"user_id"`
-	User   Patient
-	Amount float64 `json:"amount"`
+	UserID   int `json:"user_id"`
+	User     Patient
+	Amount   money.Amount `json:"amount"`
+	Currency string       `json:"currency" gorm:"not null;default:INR"`
+}
+
+// Balance is the money in the wallet
+func (wallet Wallet) Balance() money.Money {
+	return money.New(wallet.Amount, wallet.Currency)
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Statuses of a wallet top-up
+const (
+	WalletTopUpCreated  = "created"
+	WalletTopUpCredited = "credited"
+	WalletTopUpFailed   = "failed"
+	WalletTopUpRefunded = "refunded" // paid too late or over the balance limit, refunded to source
+)
+
+// WalletTopUp is an order created with a payment provider to add money to a wallet. The wallet
+// is credited once the payment is verified.
+type WalletTopUp struct {
+	ID                uint         `gorm:"primaryKey"`
+	UserID            int          `json:"user_id" gorm:"not null;index"`
+	Provider          string       `json:"provider" gorm:"not null;uniqueIndex:idx_wallet_top_ups_order"`
+	ProviderOrderID   string       `json:"provider_order_id" gorm:"not null;uniqueIndex:idx_wallet_top_ups_order"`
+	ProviderPaymentID string       `json:"provider_payment_id"` // set once the customer paid or failed to pay
+	Amount            money.Amount `json:"amount" gorm:"not null"`
+	Currency          string       `json:"currency" gorm:"not null;default:INR"`
+	Status            string       `json:"status" gorm:"not null"`
+	CreatedAt         time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"doc-connect/money"
+	"time"
+)
+
+// Types of a wallet transaction
+const (
+	WalletCredit = "credit"
+	WalletDebit  = "debit"
+)
+
+// Reasons of a wallet transaction
+const (
+	WalletReasonOpeningBalance = "opening_balance" // balance of a wallet from before the ledger
+	WalletReasonRefund         = "refund"
+	WalletReasonInvoicePayment = "invoice_payment"
+	WalletReasonTopUp          = "top_up"
+	WalletReasonReversal       = "payment_reversal" // wallet part of an invoice that wasn't paid in full
+)
+
+// WalletTransaction is an entry of the append-only wallet ledger. Every change of a wallet
+// balance is recorded as one transaction, the balance of a wallet is the sum of its credits
+// minus its debits.
+type WalletTransaction struct {
+	ID            uint         `gorm:"primaryKey"`
+	UserID        int          `json:"user_id" gorm:"not null;index"`
+	Type          string       `json:"type" gorm:"not null"` // credit or debit
+	Reason        string       `json:"reason" gorm:"not null"`
+	Description   string       `json:"description"`
+	InvoiceID     uint         `json:"invoice_id" gorm:"index"` // 0 if not linked to an invoice
+	AppointmentID int          `json:"appointment_id"`          // 0 if not linked to an appointment
+	Amount        money.Amount `json:"amount" gorm:"not null"`  // always positive
+	Currency      string       `json:"currency" gorm:"not null;default:INR"`
+	BalanceAfter  money.Amount `json:"balance_after" gorm:"not null"`
+	// IdempotencyKey identifies the change, e.g. refund:invoice:<id>, so a retry is applied once
+	IdempotencyKey string    `json:"-" gorm:"uniqueIndex:idx_wallet_transactions_key,where:idempotency_key <> ''"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// Signed is the amount the transaction changed the balance by
+func (transaction WalletTransaction) Signed() money.Amount {
+	if transaction.Type == WalletDebit {
+		return -transaction.Amount
+	}
+	return transaction.Amount
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Outcomes of a processed webhook event
+const (
+	WebhookProcessed = "processed"
+	WebhookIgnored   = "ignored"
+)
+
+// WebhookEvent records a payment gateway event so redelivered events are processed only once
+type WebhookEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	EventID   string    `json:"event_id" gorm:"not null;uniqueIndex"`
+	Event     string    `json:"event" gorm:"not null"`
+	Status    string    `json:"status"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,159 @@
+// Package money represents amounts of money exactly, as integer minor units (paise for INR).
+// Amounts are stored as integers and sent as decimal numbers in the major unit in JSON,
+// e.g. 550.50 for 55050 paise.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// INR is the currency every amount is in unless stated otherwise
+const INR = "INR"
+
+// ErrCurrencyMismatch is returned when amounts of different currencies are combined
+var ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+
+// Amount is an amount in minor units, e.g. paise
+type Amount int64
+
+// FromMajor converts an amount in the major unit, e.g. rupees, rounding half away from zero
+func FromMajor(major float64) Amount {
+	return Amount(math.Round(major * 100))
+}
+
+// Major returns the amount in the major unit, e.g. rupees. Only use it for display.
+func (a Amount) Major() float64 {
+	return float64(a) / 100
+}
+
+// Minor returns the amount in minor units as expected by payment gateways
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Percent returns a percentage of the amount, rounded half away from zero
+func (a Amount) Percent(percent float64) Amount {
+	return Amount(math.Round(float64(a) * percent / 100))
+}
+
+// Prorate returns the share part/whole of the amount, rounded half away from zero
+func (a Amount) Prorate(part, whole Amount) Amount {
+	if whole == 0 {
+		return 0
+	}
+	return Amount(math.Round(float64(a) * float64(part) / float64(whole)))
+}
+
+// String formats the amount in the major unit with two decimals, e.g. "550.50"
+func (a Amount) String() string {
+	sign := ""
+	minor := int64(a)
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/100, minor%100)
+}
+
+// MarshalJSON writes the amount as a decimal number in the major unit
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a decimal number in the major unit, as a JSON number or string
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" || text == "" {
+		return nil
+	}
+	// Parse the decimal exactly, a float would turn e.g. 550.555 into 550.55499...
+	major, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	minor := new(big.Rat).Mul(major, big.NewRat(100, 1))
+	// Round half away from zero
+	half := big.NewRat(1, 2)
+	if minor.Sign() < 0 {
+		half.Neg(half)
+	}
+	minor.Add(minor, half)
+	rounded := new(big.Int).Quo(minor.Num(), minor.Denom())
+	if !rounded.IsInt64() {
+		return fmt.Errorf("amount %s is out of range", data)
+	}
+	*a = Amount(rounded.Int64())
+	return nil
+}
+
+// Value stores the amount as an integer number of minor units
+func (a Amount) Value() (driver.Value, error) {
+	return int64(a), nil
+}
+
+// Scan reads an amount in minor units, e.g. a column or a SUM of a column
+func (a *Amount) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*a = 0
+	case int64:
+		*a = Amount(v)
+	case float64:
+		*a = Amount(math.Round(v))
+	case []byte:
+		return a.scanText(string(v))
+	case string:
+		return a.scanText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into an amount", value)
+	}
+	return nil
+}
+
+// scanText reads minor units sent as text, as postgres does for numeric sums
+func (a *Amount) scanText(text string) error {
+	minor, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into an amount", text)
+	}
+	*a = Amount(math.Round(minor))
+	return nil
+}
+
+// Money is an amount in a currency
+type Money struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// New returns an amount of minor units in a currency
+func New(amount Amount, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Add adds money of the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return m, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub subtracts money of the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return m, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// String formats the money with its currency, e.g. "INR 550.50"
+func (m Money) String() string {
+	return m.Currency + " " + m.Amount.String()
+}
@@ -0,0 +1,150 @@
+package payments
+
+import (
+	"doc-connect/money"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// fakeSecret signs the payments of the fake provider
+const fakeSecret = "fake-payment-secret"
+
+// Fake is an in-memory payment provider for local development and tests. Nothing leaves
+// the process; Pay stands in for the customer completing checkout.
+type Fake struct {
+	mu       sync.Mutex
+	seq      int
+	orders   map[string]Order
+	payments map[string]Payment
+	refunds  map[string]Refund
+	refunded map[string]money.Amount
+
+	// RefundStatus is the status new refunds start in, RefundProcessed when empty.
+	// Set it to RefundPending to exercise asynchronous reconciliation.
+	RefundStatus string
+}
+
+// NewFake creates an empty fake provider
+func NewFake() *Fake {
+	return &Fake{
+		orders:   map[string]Order{},
+		payments: map[string]Payment{},
+		refunds:  map[string]Refund{},
+		refunded: map[string]money.Amount{},
+	}
+}
+
+// Name identifies the fake provider on stored payment attempts and refunds
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// CreateOrder creates an order waiting for Pay
+func (f *Fake) CreateOrder(amount money.Money, receipt string) (Order, error) {
+	if amount.Amount <= 0 {
+		return Order{}, errors.New("amount must be positive")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	order := Order{ID: f.nextID("order"), Amount: amount}
+	f.orders[order.ID] = order
+	return order, nil
+}
+
+// Pay captures the full amount of an order as if the customer completed checkout and returns
+// the payment id with the signature checkout would return
+func (f *Fake) Pay(orderID string) (string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, ok := f.orders[orderID]
+	if !ok {
+		return "", "", ErrNotFound
+	}
+	payment := Payment{ID: f.nextID("pay"), OrderID: orderID, Amount: order.Amount, Status: "captured"}
+	f.payments[payment.ID] = payment
+	return payment.ID, sign(orderID+"|"+payment.ID, fakeSecret), nil
+}
+
+// VerifyPayment checks a signature returned by Pay
+func (f *Fake) VerifyPayment(orderID, paymentID, signature string) bool {
+	f.mu.Lock()
+	payment, ok := f.payments[paymentID]
+	f.mu.Unlock()
+	if !ok || payment.OrderID != orderID {
+		return false
+	}
+	return validSignature(orderID+"|"+paymentID, signature, fakeSecret)
+}
+
+// Refund refunds an amount of a captured payment
+func (f *Fake) Refund(paymentID string, amount money.Money, notes map[string]string) (Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, ok := f.payments[paymentID]
+	if !ok {
+		return Refund{}, ErrNotFound
+	}
+	if amount.Currency != payment.Amount.Currency {
+		return Refund{}, money.ErrCurrencyMismatch
+	}
+	if amount.Amount <= 0 || f.refunded[paymentID]+amount.Amount > payment.Amount.Amount {
+		return Refund{}, errors.New("refund amount exceeds the captured amount")
+	}
+
+	status := f.RefundStatus
+	if status == "" {
+		status = RefundProcessed
+	}
+	refund := Refund{ID: f.nextID("rfnd"), PaymentID: paymentID, Status: status}
+	f.refunds[refund.ID] = refund
+	f.refunded[paymentID] += amount.Amount
+	return refund, nil
+}
+
+// SetRefundStatus moves a refund to another status, e.g. from pending to processed
+func (f *Fake) SetRefundStatus(refundID, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	refund, ok := f.refunds[refundID]
+	if !ok {
+		return ErrNotFound
+	}
+	refund.Status = status
+	f.refunds[refundID] = refund
+	return nil
+}
+
+// FetchRefund returns the current status of a refund
+func (f *Fake) FetchRefund(refundID string) (Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	refund, ok := f.refunds[refundID]
+	if !ok {
+		return Refund{}, ErrNotFound
+	}
+	return refund, nil
+}
+
+// FetchPayment returns the current status of a payment
+func (f *Fake) FetchPayment(paymentID string) (Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, ok := f.payments[paymentID]
+	if !ok {
+		return Payment{}, ErrNotFound
+	}
+	return payment, nil
+}
+
+// nextID returns a provider style id such as pay_000000000001. The caller holds the lock.
+func (f *Fake) nextID(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_%012d", prefix, f.seq)
+}
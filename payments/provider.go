@@ -0,0 +1,73 @@
+// Package payments hides the payment gateways invoices are paid online with behind a
+// common interface, so a gateway can be swapped or faked without touching the controllers.
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"doc-connect/money"
+	"encoding/hex"
+	"errors"
+)
+
+// Refund statuses reported by providers
+const (
+	RefundPending   = "pending"
+	RefundProcessed = "processed"
+	RefundFailed    = "failed"
+)
+
+// ErrNotFound is returned when the provider doesn't know the requested order, payment or refund
+var ErrNotFound = errors.New("not found at the payment provider")
+
+// Provider is a payment gateway
+type Provider interface {
+	// Name identifies the provider on stored payment attempts and refunds
+	Name() string
+	// CreateOrder starts an online payment of the given amount
+	CreateOrder(amount money.Money, receipt string) (Order, error)
+	// VerifyPayment checks the signature checkout returned for a payment of an order
+	VerifyPayment(orderID, paymentID, signature string) bool
+	// Refund gives back an amount of a captured payment
+	Refund(paymentID string, amount money.Money, notes map[string]string) (Refund, error)
+	// FetchRefund returns the current status of a refund
+	FetchRefund(refundID string) (Refund, error)
+	// FetchPayment returns the current status of a payment
+	FetchPayment(paymentID string) (Payment, error)
+}
+
+// Order is an online payment started with a provider
+type Order struct {
+	ID     string
+	Amount money.Money
+}
+
+// Payment is a payment made by the customer for an order
+type Payment struct {
+	ID      string
+	OrderID string
+	Amount  money.Money
+	Status  string // as reported by the provider, e.g. captured or failed
+}
+
+// Refund is a refund of a payment
+type Refund struct {
+	ID        string
+	PaymentID string
+	Status    string // RefundPending, RefundProcessed or RefundFailed
+}
+
+// sign returns the hex encoded HMAC-SHA256 of a message
+func sign(message, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature compares a hex encoded HMAC-SHA256 signature in constant time
+func validSignature(message, signature, secret string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(sign(message, secret)), []byte(signature))
+}
@@ -0,0 +1,127 @@
+package payments
+
+import (
+	"doc-connect/money"
+	"errors"
+	"fmt"
+
+	"github.com/razorpay/razorpay-go"
+)
+
+// Razorpay is the Razorpay payment provider
+type Razorpay struct {
+	keyID     string
+	keySecret string
+	client    *razorpay.Client
+}
+
+// NewRazorpay creates the Razorpay provider. An empty baseURL uses the real Razorpay API,
+// otherwise e.g. the local fake API.
+func NewRazorpay(keyID, keySecret, baseURL string) *Razorpay {
+	client := razorpay.NewClient(keyID, keySecret)
+	if baseURL != "" {
+		// All resources of a client share the same request settings
+		client.Order.Request.BaseURL = baseURL
+	}
+	return &Razorpay{keyID: keyID, keySecret: keySecret, client: client}
+}
+
+// Name identifies Razorpay on stored payment attempts and refunds
+func (r *Razorpay) Name() string {
+	return "razorpay"
+}
+
+// CreateOrder creates a Razorpay order checkout is opened with
+func (r *Razorpay) CreateOrder(amount money.Money, receipt string) (Order, error) {
+	body, err := r.client.Order.Create(map[string]interface{}{
+		"amount":   amount.Amount.Minor(),
+		"currency": amount.Currency,
+		"receipt":  receipt,
+	}, nil)
+	if err != nil {
+		return Order{}, err
+	}
+
+	id, _ := body["id"].(string)
+	if id == "" {
+		return Order{}, errors.New("razorpay returned no order")
+	}
+	return Order{ID: id, Amount: amount}, nil
+}
+
+// VerifyPayment checks the checkout signature, the HMAC-SHA256 of "<order_id>|<payment_id>"
+// with the API key secret
+func (r *Razorpay) VerifyPayment(orderID, paymentID, signature string) bool {
+	if orderID == "" || paymentID == "" {
+		return false
+	}
+	return validSignature(orderID+"|"+paymentID, signature, r.keySecret)
+}
+
+// Refund refunds an amount of a captured Razorpay payment
+func (r *Razorpay) Refund(paymentID string, amount money.Money, notes map[string]string) (Refund, error) {
+	data := map[string]interface{}{}
+	if len(notes) > 0 {
+		data["notes"] = notes
+	}
+	body, err := r.client.Payment.Refund(paymentID, int(amount.Amount.Minor()), data, nil)
+	if err != nil {
+		return Refund{}, err
+	}
+	return refundFromBody(body)
+}
+
+// FetchRefund returns the current status of a Razorpay refund
+func (r *Razorpay) FetchRefund(refundID string) (Refund, error) {
+	body, err := r.client.Refund.Fetch(refundID, nil, nil)
+	if err != nil {
+		return Refund{}, err
+	}
+	return refundFromBody(body)
+}
+
+// FetchPayment returns the current status of a Razorpay payment
+func (r *Razorpay) FetchPayment(paymentID string) (Payment, error) {
+	body, err := r.client.Payment.Fetch(paymentID, nil, nil)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	id, _ := body["id"].(string)
+	if id == "" {
+		return Payment{}, ErrNotFound
+	}
+	orderID, _ := body["order_id"].(string)
+	status, _ := body["status"].(string)
+	amount, _ := body["amount"].(float64)
+	currency, _ := body["currency"].(string)
+	return Payment{ID: id, OrderID: orderID, Amount: money.New(money.Amount(amount), currency), Status: status}, nil
+}
+
+// VerifyRazorpayWebhook checks the X-Razorpay-Signature header of a webhook, the HMAC-SHA256
+// of the raw request body with the webhook secret
+func VerifyRazorpayWebhook(body []byte, signature, webhookSecret string) bool {
+	return validSignature(string(body), signature, webhookSecret)
+}
+
+// refundFromBody reads a refund from a Razorpay API response
+func refundFromBody(body map[string]interface{}) (Refund, error) {
+	id, _ := body["id"].(string)
+	if id == "" {
+		return Refund{}, errors.New("razorpay returned no refund")
+	}
+	paymentID, _ := body["payment_id"].(string)
+
+	refund := Refund{ID: id, PaymentID: paymentID}
+	switch body["status"] {
+	case "processed":
+		refund.Status = RefundProcessed
+	case "failed":
+		refund.Status = RefundFailed
+	case "pending":
+		refund.Status = RefundPending
+	default:
+		return refund, fmt.Errorf("razorpay returned unknown refund status %v", body["status"])
+	}
+	return refund, nil
+}
@@ -0,0 +1,155 @@
+package payments_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"doc-connect/money"
+	"doc-connect/payments"
+	"doc-connect/razorpayfake"
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+)
+
+const testKeySecret = "test-key-secret"
+
+// newTestRazorpay returns the Razorpay provider talking to a fresh fake Razorpay API
+func newTestRazorpay(t *testing.T) (*payments.Razorpay, *razorpayfake.Server) {
+	t.Helper()
+	fake := razorpayfake.New()
+	server := httptest.NewServer(fake.Handler())
+	t.Cleanup(server.Close)
+	return payments.NewRazorpay("rzp_test_key", testKeySecret, server.URL), fake
+}
+
+func hmacHex(message, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// paidOrder creates an order and pays it in full, returning the order and payment ids
+func paidOrder(t *testing.T, provider *payments.Razorpay, fake *razorpayfake.Server, amount money.Money) (string, string) {
+	t.Helper()
+	order, err := provider.CreateOrder(amount, "receipt-1")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	payment, ok := fake.PayOrder(order.ID)
+	if !ok {
+		t.Fatalf("PayOrder: order %s not found", order.ID)
+	}
+	return order.ID, payment["id"].(string)
+}
+
+func TestRazorpayCreateOrder(t *testing.T) {
+	provider, _ := newTestRazorpay(t)
+
+	amount := money.New(55050, money.INR)
+	order, err := provider.CreateOrder(amount, "invoice-7")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if order.ID == "" || order.Amount != amount {
+		t.Errorf("CreateOrder = %+v, want an order id and amount %v", order, amount)
+	}
+
+	if _, err := provider.CreateOrder(money.New(0, money.INR), "invoice-8"); err == nil {
+		t.Error("CreateOrder of a zero amount succeeded, want the API error")
+	}
+}
+
+func TestRazorpayVerifyPayment(t *testing.T) {
+	provider, fake := newTestRazorpay(t)
+	orderID, paymentID := paidOrder(t, provider, fake, money.New(50000, money.INR))
+
+	tests := []struct {
+		name      string
+		orderID   string
+		paymentID string
+		signature string
+		want      bool
+	}{
+		{"valid signature", orderID, paymentID, hmacHex(orderID+"|"+paymentID, testKeySecret), true},
+		{"signed with another secret", orderID, paymentID, hmacHex(orderID+"|"+paymentID, "other-secret"), false},
+		{"signature of another payment", orderID, "pay_other", hmacHex(orderID+"|"+paymentID, testKeySecret), false},
+		{"missing signature", orderID, paymentID, "", false},
+		{"missing order", "", paymentID, hmacHex("|"+paymentID, testKeySecret), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := provider.VerifyPayment(tt.orderID, tt.paymentID, tt.signature); got != tt.want {
+				t.Errorf("VerifyPayment = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRazorpayFetchPayment(t *testing.T) {
+	provider, fake := newTestRazorpay(t)
+	orderID, paymentID := paidOrder(t, provider, fake, money.New(50000, money.INR))
+
+	payment, err := provider.FetchPayment(paymentID)
+	if err != nil {
+		t.Fatalf("FetchPayment: %v", err)
+	}
+	if payment.OrderID != orderID || payment.Status != "captured" || payment.Amount != money.New(50000, money.INR) {
+		t.Errorf("FetchPayment = %+v, want a captured payment of 500.00 INR for %s", payment, orderID)
+	}
+}
+
+func TestRazorpayRefund(t *testing.T) {
+	provider, fake := newTestRazorpay(t)
+	_, paymentID := paidOrder(t, provider, fake, money.New(50000, money.INR))
+
+	refund, err := provider.Refund(paymentID, money.New(20000, money.INR), map[string]string{"invoice_id": "1"})
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if refund.ID == "" || refund.PaymentID != paymentID || refund.Status != payments.RefundProcessed {
+		t.Errorf("Refund = %+v, want a processed refund of %s", refund, paymentID)
+	}
+
+	// More than what is left of the payment can't be refunded
+	if _, err := provider.Refund(paymentID, money.New(40000, money.INR), nil); err == nil {
+		t.Error("Refund of more than the captured amount succeeded, want the API error")
+	}
+}
+
+func TestRazorpayFetchRefund(t *testing.T) {
+	provider, fake := newTestRazorpay(t)
+	fake.RefundStatus = "pending"
+	_, paymentID := paidOrder(t, provider, fake, money.New(50000, money.INR))
+
+	refund, err := provider.Refund(paymentID, money.New(50000, money.INR), nil)
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if refund.Status != payments.RefundPending {
+		t.Fatalf("Refund status = %s, want %s", refund.Status, payments.RefundPending)
+	}
+
+	for _, status := range []string{payments.RefundProcessed, payments.RefundFailed} {
+		fake.SetRefundStatus(refund.ID, status)
+		fetched, err := provider.FetchRefund(refund.ID)
+		if err != nil {
+			t.Fatalf("FetchRefund: %v", err)
+		}
+		if fetched.Status != status {
+			t.Errorf("FetchRefund status = %s, want %s", fetched.Status, status)
+		}
+	}
+}
+
+func TestVerifyRazorpayWebhook(t *testing.T) {
+	body := []byte(`{"event":"payment.captured"}`)
+	if !payments.VerifyRazorpayWebhook(body, hmacHex(string(body), "webhook-secret"), "webhook-secret") {
+		t.Error("valid webhook signature was rejected")
+	}
+	if payments.VerifyRazorpayWebhook(body, hmacHex(string(body), "other-secret"), "webhook-secret") {
+		t.Error("webhook signed with another secret was accepted")
+	}
+	if payments.VerifyRazorpayWebhook(body, hmacHex(string(body), ""), "") {
+		t.Error("webhook was accepted without a configured secret")
+	}
+}
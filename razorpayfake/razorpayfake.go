@@ -0,0 +1,221 @@
+// Package razorpayfake is a local stand-in for the parts of the Razorpay HTTP API the server
+// uses. Orders, payments and refunds are kept in memory, so payment and refund flows can be
+// exercised without a Razorpay account by pointing RAZORPAY_BASE_URL at it.
+package razorpayfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server keeps the state of the fake Razorpay account
+type Server struct {
+	mu       sync.Mutex
+	seq      int
+	orders   map[string]map[string]interface{}
+	payments map[string]map[string]interface{}
+	refunds  map[string]map[string]interface{}
+
+	// RefundStatus is the status new refunds start in, "processed" when empty.
+	// Set it to "pending" to exercise asynchronous reconciliation.
+	RefundStatus string
+}
+
+// New creates an empty fake Razorpay account
+func New() *Server {
+	return &Server{
+		orders:   map[string]map[string]interface{}{},
+		payments: map[string]map[string]interface{}{},
+		refunds:  map[string]map[string]interface{}{},
+	}
+}
+
+// Handler serves the fake API, e.g. through httptest.NewServer. Besides the Razorpay endpoints it has
+// POST /fake/orders/{id}/pay to simulate a customer paying an order and
+// POST /fake/refunds/{id}?status=... to move a refund to another status.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/orders", s.handleOrders)
+	mux.HandleFunc("/v1/payments/", s.handlePayments)
+	mux.HandleFunc("/v1/refunds/", s.handleRefunds)
+	mux.HandleFunc("/fake/orders/", s.handlePayOrder)
+	mux.HandleFunc("/fake/refunds/", s.handleSetRefundStatus)
+	return mux
+}
+
+// PayOrder simulates a captured payment of the full order amount and returns the payment
+func (s *Server) PayOrder(orderID string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return nil, false
+	}
+	payment := map[string]interface{}{
+		"id":              s.nextID("pay"),
+		"entity":          "payment",
+		"order_id":        orderID,
+		"amount":          order["amount"],
+		"currency":        order["currency"],
+		"status":          "captured",
+		"amount_refunded": 0,
+		"created_at":      time.Now().Unix(),
+	}
+	s.payments[payment["id"].(string)] = payment
+	order["status"] = "paid"
+	return payment, true
+}
+
+// SetRefundStatus moves a refund to another status, e.g. from pending to processed
+func (s *Server) SetRefundStatus(refundID, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refund, ok := s.refunds[refundID]
+	if ok {
+		refund["status"] = status
+	}
+	return ok
+}
+
+func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	amount, ok := body["amount"].(float64)
+	if !ok || amount <= 0 {
+		writeError(w, http.StatusBadRequest, "The amount must be at least INR 1.00")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order := map[string]interface{}{
+		"id":         s.nextID("order"),
+		"entity":     "order",
+		"amount":     int(amount),
+		"currency":   body["currency"],
+		"receipt":    body["receipt"],
+		"status":     "created",
+		"created_at": time.Now().Unix(),
+	}
+	s.orders[order["id"].(string)] = order
+	writeJSON(w, order)
+}
+
+// handlePayments serves GET /v1/payments/{id} and POST /v1/payments/{id}/refund
+func (s *Server) handlePayments(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/payments/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[parts[0]]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, payment)
+	case len(parts) == 2 && parts[1] == "refund" && r.Method == http.MethodPost:
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		amount, _ := body["amount"].(float64)
+		refundable := payment["amount"].(int) - payment["amount_refunded"].(int)
+		if amount <= 0 || int(amount) > refundable {
+			writeError(w, http.StatusBadRequest, "The refund amount provided is greater than amount captured")
+			return
+		}
+
+		status := s.RefundStatus
+		if status == "" {
+			status = "processed"
+		}
+		refund := map[string]interface{}{
+			"id":         s.nextID("rfnd"),
+			"entity":     "refund",
+			"payment_id": payment["id"],
+			"amount":     int(amount),
+			"currency":   payment["currency"],
+			"notes":      body["notes"],
+			"status":     status,
+			"created_at": time.Now().Unix(),
+		}
+		s.refunds[refund["id"].(string)] = refund
+		payment["amount_refunded"] = payment["amount_refunded"].(int) + int(amount)
+		writeJSON(w, refund)
+	default:
+		writeError(w, http.StatusNotFound, "The requested URL was not found on the server")
+	}
+}
+
+// handleRefunds serves GET /v1/refunds/{id}
+func (s *Server) handleRefunds(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refund, ok := s.refunds[strings.TrimPrefix(r.URL.Path, "/v1/refunds/")]
+	if !ok || r.Method != http.MethodGet {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+	writeJSON(w, refund)
+}
+
+func (s *Server) handlePayOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/fake/orders/"), "/pay")
+	payment, ok := s.PayOrder(orderID)
+	if !ok || r.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+	writeJSON(w, payment)
+}
+
+func (s *Server) handleSetRefundStatus(w http.ResponseWriter, r *http.Request) {
+	refundID := strings.TrimPrefix(r.URL.Path, "/fake/refunds/")
+	if r.Method != http.MethodPost || !s.SetRefundStatus(refundID, r.URL.Query().Get("status")) {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// nextID returns a Razorpay style id such as pay_000000000001. The caller holds the lock.
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s_%012d", prefix, s.seq)
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers in the error format of the Razorpay API
+func writeError(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":        "BAD_REQUEST_ERROR",
+			"description": description,
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package refundpolicy
+
+import (
+	"doc-connect/models"
+	"doc-connect/money"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Cancellation describes a cancelled appointment the policy is evaluated for
+type Cancellation struct {
+	CancelledBy   string    // patient or doctor
+	PaymentMethod string    // payment method of the invoice
+	SlotStart     time.Time // start of the cancelled slot
+	CancelledAt   time.Time
+	PaidAmount    money.Amount
+}
+
+// Decision is the outcome of evaluating the policy for a cancellation
+type Decision struct {
+	RuleID        uint         `json:"rule_id,omitempty"`
+	RuleName      string       `json:"rule_name"`
+	CancelledBy   string       `json:"cancelled_by"`
+	PaymentMethod string       `json:"payment_method"`
+	HoursBefore   float64      `json:"hours_before"`
+	RefundPercent float64      `json:"refund_percent"`
+	RefundAmount  money.Amount `json:"refund_amount"`
+}
+
+// DefaultRules are the rules a new installation starts with
+func DefaultRules() []models.RefundRule {
+	return []models.RefundRule{
+		{Name: "Cancelled by doctor", CancelledBy: "doctor", PaymentMethod: models.RefundRuleAnyMethod, RefundPercent: 100, Priority: 10, Active: true},
+		{Name: "Paid offline", CancelledBy: models.RefundRuleAnyCanceller, PaymentMethod: "Offline", RefundPercent: 0, Priority: 20, Active: true},
+		{Name: "More than 24 hours ahead", CancelledBy: "patient", PaymentMethod: models.RefundRuleAnyMethod, MinHoursBefore: 24, RefundPercent: 100, Priority: 30, Active: true},
+		{Name: "Within 24 hours", CancelledBy: "patient", PaymentMethod: models.RefundRuleAnyMethod, RefundPercent: 50, Priority: 40, Active: true},
+	}
+}
+
+// Matches reports whether a rule applies to a cancellation made the given hours before the slot
+func Matches(rule models.RefundRule, cancellation Cancellation, hoursBefore float64) bool {
+	if !rule.Active {
+		return false
+	}
+	if rule.CancelledBy != models.RefundRuleAnyCanceller && rule.CancelledBy != cancellation.CancelledBy {
+		return false
+	}
+	if rule.PaymentMethod != models.RefundRuleAnyMethod && rule.PaymentMethod != cancellation.PaymentMethod {
+		return false
+	}
+	return hoursBefore >= float64(rule.MinHoursBefore)
+}
+
+// Evaluate picks the first matching active rule by priority and computes the refund.
+// Without a matching rule nothing is refunded.
+func Evaluate(tx *gorm.DB, cancellation Cancellation) (Decision, error) {
+	hoursBefore := cancellation.SlotStart.Sub(cancellation.CancelledAt).Hours()
+	decision := Decision{
+		RuleName:      "No matching rule",
+		CancelledBy:   cancellation.CancelledBy,
+		PaymentMethod: cancellation.PaymentMethod,
+		HoursBefore:   math.Round(hoursBefore*100) / 100,
+	}
+
+	var rules []models.RefundRule
+	if err := tx.Where("active = ?", true).Order("priority, id").Find(&rules).Error; err != nil {
+		return decision, err
+	}
+
+	for _, rule := range rules {
+		if !Matches(rule, cancellation, hoursBefore) {
+			continue
+		}
+		decision.RuleID = rule.ID
+		decision.RuleName = rule.Name
+		decision.RefundPercent = rule.RefundPercent
+		decision.RefundAmount = cancellation.PaidAmount.Percent(rule.RefundPercent)
+		break
+	}
+	return decision, nil
+}
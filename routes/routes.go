@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"doc-connect/access"
 	"doc-connect/authentication"
 	"doc-connect/controllers"
 
@@ -15,52 +16,126 @@ func UserRoutes() *gin.Engine {
 	r.POST("/users/login", controllers.PatientLogin)
 	r.POST("/users/signup", controllers.PatientSignup)
 	r.POST("/users/verify", controllers.UserOtpVerify)
+	r.POST("/token/refresh", controllers.RefreshToken)
 	r.GET("/pay/invoice/online", controllers.MakePaymentOnline)
 	r.GET("/payment/success", controllers.SuccessPage)
+	r.GET("/payment/fake/checkout", controllers.FakeCheckout)
+	r.GET("/wallet/topup/checkout", controllers.TopUpCheckout)
+	r.GET("/wallet/topup/success", controllers.TopUpSuccess)
+	r.POST("/webhooks/razorpay", controllers.RazorpayWebhook)
+	r.POST("/waitlist/claim", controllers.ClaimWaitlistOffer)
 
 	user := r.Group("/user")
 	user.Use(authentication.PatientAuthMiddleware())
 	{
 		user.GET("/doctors/:doctor_id/available-slots", controllers.GetAvailableTimeSlots)
 		user.GET("/logout", controllers.PatientLogout)
+		user.GET("/view/sessions", controllers.ViewSessions)
+		user.POST("/revoke/session/:id", controllers.RevokeSession)
 		user.GET("/doctor/:specialization", controllers.GetDoctorsBySpeciality)
 		user.POST("/book/appointment", controllers.BookAppointment)
 		user.POST("/pay/invoice/offline", controllers.PayInvoiceOffline)
 		user.GET("/wallet/:userid", controllers.Wallet)
+		user.GET("/wallet/transactions", controllers.WalletTransactions)
+		user.GET("/wallet/statement", controllers.WalletStatement)
+		user.POST("/wallet/topup", controllers.TopUpWallet)
 		user.POST("/cancel/appointment/:id", controllers.CancelAppointment)
+		user.POST("/checkin/appointment/:id", controllers.CheckInAppointment)
 		user.GET("/appointment/history/:id", controllers.GetAppointmenentHistory)
 		user.POST("/pay/invoice/wallet", controllers.PayFromWallet)
+		user.POST("/reschedule/appointment/:id", controllers.RescheduleAppointment)
+		user.GET("/reschedule/history/:id", controllers.GetRescheduleHistory)
+		user.POST("/join/waitlist", controllers.JoinWaitlist)
+		user.GET("/view/waitlist", controllers.ViewWaitlist)
+		user.POST("/leave/waitlist/:id", controllers.LeaveWaitlist)
+		user.POST("/apply/coupon", controllers.ApplyCoupon)
 
 	}
 
 	//Admin routes
 
 	r.POST("/admin/login", controllers.AdminLogin)
+	r.POST("/admin/set/password", controllers.SetAdminPassword)
 
+	// Every admin route needs the permission of its group, see access.Permission
 	admin := r.Group("/admin")
-	admin.Use(authentication.AdminAuthMiddleware())
 	{
-		admin.POST("/logout", controllers.AdminLogout)
-		admin.GET("/view/hospitals", controllers.ViewHospitals)
-		admin.POST("/add/hospital", controllers.AddHospital)
-		admin.GET("/search/hospital/:id", controllers.SearchHospital)
-		admin.PATCH("/update/hospital/:id", controllers.UpdateHospital)
-		admin.POST("/remove/hospital/:id", controllers.RemoveHospital)
-		admin.GET("/view/deleted/hospitals", controllers.ViewDeletedHospitals)
-		admin.GET("/view/Active/hospitals", controllers.ViewActiveHospitals)
-		admin.POST("/verify/doctor/:id", controllers.UpdateDoctor)
-		admin.GET("/view/verified/doctors", controllers.ViewVerifiedDoctors)
-		admin.GET("/view/doctor/:id", controllers.GetDoctorByID)
-		admin.GET("/view/doctors/:specialization", controllers.GetDoctorBySpeciality)
-		admin.GET("/view/notVerified/doctors", controllers.ViewNotVerifiedDoctors)
-		admin.GET("/view/verified/approved/doctors", controllers.ViewVerifiedApprovedDoctors)
-		admin.GET("/view/verified/notApproved/doctors", controllers.ViewVerifiedNotApprovedDoctors)
-		admin.GET("/view/invoice", controllers.GetInvoice)
-		admin.GET("/total/appointments", controllers.GetBookingStatusCounts)
-		admin.GET("/doctor-wise/bookings", controllers.GetDoctorWiseBookings)
-		admin.GET("/department-wise/bookings", controllers.GetDepartmentWiseBookings)
-		admin.GET("/total/revenue", controllers.GetTotalRevenue)
-		admin.GET("/revenue/startdate", controllers.GetSpecificRevenue)
+		anyAdmin := admin.Group("", authentication.AdminAuthMiddleware())
+		anyAdmin.POST("/logout", controllers.AdminLogout)
+		anyAdmin.GET("/view/sessions", controllers.ViewSessions)
+		anyAdmin.POST("/revoke/session/:id", controllers.RevokeSession)
+
+		hospitals := admin.Group("", authentication.AdminAuthMiddleware(access.ManageHospitals))
+		hospitals.GET("/view/hospitals", controllers.ViewHospitals)
+		hospitals.POST("/add/hospital", controllers.AddHospital)
+		hospitals.GET("/search/hospital/:id", controllers.SearchHospital)
+		hospitals.PATCH("/update/hospital/:id", controllers.UpdateHospital)
+		hospitals.POST("/remove/hospital/:id", controllers.RemoveHospital)
+		hospitals.GET("/view/deleted/hospitals", controllers.ViewDeletedHospitals)
+		hospitals.GET("/view/Active/hospitals", controllers.ViewActiveHospitals)
+		hospitals.POST("/add/hospital/staff", controllers.AddHospitalStaff)
+		hospitals.GET("/view/hospital/staff/:id", controllers.ViewHospitalStaff)
+		hospitals.POST("/disable/hospital/staff/:id", controllers.DisableHospitalStaff)
+		hospitals.POST("/enable/hospital/staff/:id", controllers.EnableHospitalStaff)
+		hospitals.POST("/reset/hospital/staff/password/:id", controllers.ResetHospitalStaffPassword)
+
+		doctors := admin.Group("", authentication.AdminAuthMiddleware(access.ViewDoctors))
+		doctors.GET("/view/verified/doctors", controllers.ViewVerifiedDoctors)
+		doctors.GET("/view/doctor/:id", controllers.GetDoctorByID)
+		doctors.GET("/view/doctors/:specialization", controllers.GetDoctorBySpeciality)
+		doctors.GET("/view/notVerified/doctors", controllers.ViewNotVerifiedDoctors)
+		doctors.GET("/view/verified/approved/doctors", controllers.ViewVerifiedApprovedDoctors)
+		doctors.GET("/view/verified/notApproved/doctors", controllers.ViewVerifiedNotApprovedDoctors)
+
+		verification := admin.Group("", authentication.AdminAuthMiddleware(access.VerifyDoctors))
+		verification.POST("/verify/doctor/:id", controllers.UpdateDoctor)
+
+		bookings := admin.Group("", authentication.AdminAuthMiddleware(access.ViewBookings))
+		bookings.GET("/total/appointments", controllers.GetBookingStatusCounts)
+		bookings.GET("/doctor-wise/bookings", controllers.GetDoctorWiseBookings)
+		bookings.GET("/department-wise/bookings", controllers.GetDepartmentWiseBookings)
+		bookings.GET("/appointment/transitions/:id", controllers.GetAppointmentTransitions)
+		bookings.GET("/patient/noshows", controllers.GetNoShowCounts)
+		bookings.GET("/view/booking/policy", controllers.ViewBookingPolicy)
+
+		bookingPolicy := admin.Group("", authentication.AdminAuthMiddleware(access.ManageBookingPolicy))
+		bookingPolicy.POST("/update/booking/policy", controllers.UpdateBookingPolicy)
+
+		revenue := admin.Group("", authentication.AdminAuthMiddleware(access.ViewRevenue))
+		revenue.GET("/total/revenue", controllers.GetTotalRevenue)
+		revenue.GET("/revenue/startdate", controllers.GetSpecificRevenue)
+
+		billing := admin.Group("", authentication.AdminAuthMiddleware(access.ManageBilling))
+		billing.GET("/view/invoice", controllers.GetInvoice)
+		billing.POST("/add/refund/rule", controllers.AddRefundRule)
+		billing.GET("/view/refund/rules", controllers.ViewRefundRules)
+		billing.PATCH("/update/refund/rule/:id", controllers.UpdateRefundRule)
+		billing.POST("/remove/refund/rule/:id", controllers.RemoveRefundRule)
+		billing.GET("/view/refunds", controllers.ViewRefunds)
+		billing.POST("/add/coupon", controllers.AddCoupon)
+		billing.GET("/view/coupons", controllers.ViewCoupons)
+		billing.PATCH("/update/coupon/:id", controllers.UpdateCoupon)
+		billing.GET("/coupon/redemptions/:id", controllers.ViewCouponRedemptions)
+
+		payouts := admin.Group("", authentication.AdminAuthMiddleware(access.ManagePayouts))
+		payouts.POST("/add/commission", controllers.AddCommission)
+		payouts.GET("/view/commissions", controllers.ViewCommissions)
+		payouts.PATCH("/update/commission/:id", controllers.UpdateCommission)
+		payouts.POST("/remove/commission/:id", controllers.RemoveCommission)
+		payouts.POST("/generate/payouts", controllers.GeneratePayouts)
+		payouts.GET("/view/payouts", controllers.ViewPayouts)
+		payouts.PATCH("/update/payout/:id", controllers.UpdatePayoutStatus)
+
+		jobs := admin.Group("", authentication.AdminAuthMiddleware(access.ViewJobs))
+		jobs.GET("/job/runs", controllers.GetJobRuns)
+
+		admins := admin.Group("", authentication.AdminAuthMiddleware(access.ManageAdmins))
+		admins.POST("/invite/admin", controllers.InviteAdmin)
+		admins.GET("/view/admins", controllers.ViewAdmins)
+		admins.PATCH("/update/admin/role/:id", controllers.UpdateAdminRole)
+		admins.POST("/disable/admin/:id", controllers.DisableAdmin)
+		admins.POST("/enable/admin/:id", controllers.EnableAdmin)
+		admins.POST("/reset/admin/password/:id", controllers.ResetAdminPassword)
 	}
 
 	//Doctor routes
@@ -74,11 +149,59 @@ func UserRoutes() *gin.Engine {
 	doctors.Use(authentication.DoctorAuthMiddleware())
 	{
 		doctors.POST("/update/availability", controllers.SaveAvailability)
+		doctors.POST("/remove/availability/:id", controllers.RemoveAvailability)
+		doctors.POST("/add/weekly/schedule", controllers.SaveWeeklySchedule)
+		doctors.GET("/view/weekly/schedule", controllers.ViewWeeklySchedule)
+		doctors.POST("/remove/weekly/schedule/:id", controllers.RemoveWeeklySchedule)
+		doctors.POST("/add/blackout", controllers.AddBlackoutDate)
+		doctors.GET("/view/blackouts", controllers.ViewBlackoutDates)
+		doctors.POST("/remove/blackout/:id", controllers.RemoveBlackoutDate)
 		doctors.GET("/logout", controllers.DoctorLogout)
+		doctors.GET("/view/sessions", controllers.ViewSessions)
+		doctors.POST("/revoke/session/:id", controllers.RevokeSession)
+		doctors.POST("/checkin/appointment/:id", controllers.CheckInAppointment)
+		doctors.POST("/mark/noshow/:id", controllers.MarkNoShow)
+		doctors.POST("/start/consultation/:id", controllers.StartConsultation)
 		doctors.POST("/add/prescription", controllers.AddPrescription)
 		doctors.POST("/cancel/appointment/:id", controllers.CancelAppointment)
 		doctors.GET("/appointment/history/:id", controllers.GetAppHistory)
 		doctors.GET("/appointment/:doctor_id/date", controllers.GetDoctorAppointmentsByDate)
+		doctors.POST("/reschedule/appointment/:id", controllers.RescheduleAppointment)
+		doctors.GET("/reschedule/history/:id", controllers.GetRescheduleHistory)
+		doctors.POST("/add/invoice/item/:id", controllers.AddInvoiceItem)
+		doctors.POST("/remove/invoice/item/:id", controllers.RemoveInvoiceItem)
+		doctors.GET("/view/earnings", controllers.ViewEarnings)
+		doctors.GET("/view/payouts", controllers.ViewDoctorPayouts)
+		doctors.GET("/payout/statement/:id", controllers.PayoutStatement)
+	}
+
+	//Hospital staff routes
+	r.POST("/staff/login", controllers.StaffLogin)
+	r.POST("/staff/set/password", controllers.SetStaffPassword)
+
+	staff := r.Group("/staff")
+	staff.Use(authentication.StaffAuthMiddleware())
+	{
+		staff.POST("/logout", controllers.StaffLogout)
+		staff.GET("/view/sessions", controllers.ViewSessions)
+		staff.POST("/revoke/session/:id", controllers.RevokeSession)
+		staff.GET("/view/doctors", controllers.ViewHospitalDoctors)
+		staff.GET("/view/appointments", controllers.ViewHospitalAppointments)
+		staff.GET("/hospital/report", controllers.GetHospitalReport)
+		staff.POST("/checkin/appointment/:id", controllers.CheckInAppointment)
+		staff.POST("/mark/noshow/:id", controllers.MarkNoShow)
+		staff.POST("/pay/invoice/offline", controllers.PayInvoiceOffline)
+
+		// Schedules of the doctors of the staff's hospital
+		schedule := staff.Group("/doctor/:doctor_id", authentication.StaffDoctorMiddleware())
+		schedule.POST("/update/availability", controllers.SaveAvailability)
+		schedule.POST("/remove/availability/:id", controllers.RemoveAvailability)
+		schedule.POST("/add/weekly/schedule", controllers.SaveWeeklySchedule)
+		schedule.GET("/view/weekly/schedule", controllers.ViewWeeklySchedule)
+		schedule.POST("/remove/weekly/schedule/:id", controllers.RemoveWeeklySchedule)
+		schedule.POST("/add/blackout", controllers.AddBlackoutDate)
+		schedule.GET("/view/blackouts", controllers.ViewBlackoutDates)
+		schedule.POST("/remove/blackout/:id", controllers.RemoveBlackoutDate)
 	}
 
 	return r
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"doc-connect/configuration"
+	"doc-connect/models"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseLock deletes a job's lock only if it still holds the owner's token, so a run that
+// outlived its lock doesn't release the lock of the run that took over
+var releaseLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Job is a task that runs periodically inside the server process
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Run does one pass of the job and returns the number of records it processed
+	Run func() (int, error)
+}
+
+// Start runs every job on its own ticker in the background
+func Start(jobs ...Job) {
+	for _, job := range jobs {
+		go schedule(job)
+	}
+}
+
+// schedule runs a job once at startup and then on every tick
+func schedule(job Job) {
+	log.Printf("Scheduled job %s every %s\n", job.Name, job.Interval)
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		runJob(job)
+		<-ticker.C
+	}
+}
+
+// runJob runs a job and records the run in the job_runs table. The run is skipped when
+// another server instance holds the job's lock.
+func runJob(job Job) {
+	lockKey := "job-lock:" + job.Name
+	owner := uuid.New().String()
+	acquired, err := configuration.Client.SetNX(context.Background(), lockKey, owner, job.Interval).Result()
+	if err != nil {
+		log.Printf("Failed to acquire lock for job %s: %s\n", job.Name, err.Error())
+		return
+	}
+	if !acquired {
+		return
+	}
+	defer func() {
+		if err := releaseLock.Run(context.Background(), configuration.Client, []string{lockKey}, owner).Err(); err != nil {
+			log.Printf("Failed to release lock for job %s: %s\n", job.Name, err.Error())
+		}
+	}()
+
+	run := models.JobRun{
+		JobName:   job.Name,
+		StartedAt: time.Now(),
+		Status:    "running",
+	}
+	if err := configuration.DB.Create(&run).Error; err != nil {
+		log.Printf("Failed to record run of job %s: %s\n", job.Name, err.Error())
+	}
+
+	processed, err := safeRun(job)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Processed = processed
+	run.Status = "success"
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		log.Printf("Job %s failed: %s\n", job.Name, err.Error())
+	}
+	if err := configuration.DB.Save(&run).Error; err != nil {
+		log.Printf("Failed to record run of job %s: %s\n", job.Name, err.Error())
+	}
+}
+
+// safeRun runs a job turning a panic into an error so the scheduler keeps going
+func safeRun(job Job) (processed int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run()
+}